@@ -0,0 +1,147 @@
+package guardian
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// AddressList : Recipients an admin has listed, with a label for each.  The global list applies to
+// everyone, others to one Okta group or user.
+type AddressList struct {
+	Mode string `json:"mode"`
+	// Addresses maps lowercase 0x prefixed addresses to their labels
+	Addresses map[string]string `json:"addresses"`
+}
+
+// Address list modes.  valueAllowlistMode only holds transactions which send value to the
+// allowlist, so zero-value contract calls may go to any address.
+const (
+	allowlistMode      = "allowlist"
+	denylistMode       = "denylist"
+	valueAllowlistMode = "value_allowlist"
+)
+
+const (
+	// Lists are kept apart from the address owners stored under addresses/
+	addressListStoragePrefix = "address-lists/"
+	globalAddressListScope   = "global"
+	userAddressListScope     = "users/"
+	groupAddressListScope    = "groups/"
+)
+
+func validAddressListMode(mode string) bool {
+	return mode == allowlistMode || mode == denylistMode || mode == valueAllowlistMode
+}
+
+// describeScope : How a list's scope reads in a violation, like "group traders"
+func describeScope(scope string) string {
+	switch {
+	case strings.HasPrefix(scope, userAddressListScope):
+		return "user " + strings.TrimPrefix(scope, userAddressListScope)
+	case strings.HasPrefix(scope, groupAddressListScope):
+		return "group " + strings.TrimPrefix(scope, groupAddressListScope)
+	}
+	return scope
+}
+
+// violation : Describes how the transaction breaks the list, or is empty if it doesn't.
+// Contract deployments have no recipient, so allowlists only let them through if they send nothing.
+func (list *AddressList) violation(scope string, args *txArgs) string {
+	sendsValue := args.Amount != nil && args.Amount.Sign() > 0
+	var recipient, label string
+	var listed bool
+	if args.To != nil {
+		recipient = args.To.Hex()
+		label, listed = list.Addresses[strings.ToLower(recipient)]
+	}
+	switch list.Mode {
+	case denylistMode:
+		if listed {
+			return fmt.Sprintf("%s (%s) is on the %s denylist", recipient, label, describeScope(scope))
+		}
+		return ""
+	case valueAllowlistMode:
+		if !sendsValue {
+			return ""
+		}
+	}
+	if args.To == nil {
+		if sendsValue || list.Mode == allowlistMode {
+			return fmt.Sprintf("contract deployments are not on the %s allowlist", describeScope(scope))
+		}
+		return ""
+	}
+	if !listed {
+		return fmt.Sprintf("%s is not on the %s allowlist", recipient, describeScope(scope))
+	}
+	return ""
+}
+
+func (b *backend) readAddressList(ctx context.Context, s logical.Storage, scope string) (*AddressList, error) {
+	entry, err := s.Get(ctx, addressListStoragePrefix+scope)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var list AddressList
+	if err := entry.DecodeJSON(&list); err != nil {
+		return nil, err
+	}
+	if list.Addresses == nil {
+		list.Addresses = map[string]string{}
+	}
+	return &list, nil
+}
+
+func (b *backend) writeAddressList(ctx context.Context, s logical.Storage, scope string, list *AddressList) error {
+	entry, err := logical.StorageEntryJSON(addressListStoragePrefix+scope, list)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// addressListScopes : The scopes whose lists could apply to the user, the global one, their own and their
+// Okta groups' which have a list
+func (b *backend) addressListScopes(ctx context.Context, s logical.Storage, user *policyUser) ([]string, error) {
+	scopes := []string{globalAddressListScope, userAddressListScope + user.username}
+	groups, err := b.groupsWithPolicy(ctx, s, user, addressListStoragePrefix+groupAddressListScope)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		scopes = append(scopes, groupAddressListScope+group)
+	}
+	return scopes, nil
+}
+
+// recipientViolations : How the transactions break the global address list, the user's own, or those of
+// their Okta groups.  Every list which applies must be satisfied.
+func (b *backend) recipientViolations(ctx context.Context, s logical.Storage, user *policyUser, txs []*txArgs) ([]string, error) {
+	scopes, err := b.addressListScopes(ctx, s, user)
+	if err != nil {
+		return nil, err
+	}
+
+	violations := []string{}
+	for _, scope := range scopes {
+		list, err := b.readAddressList(ctx, s, scope)
+		if err != nil {
+			return nil, err
+		}
+		if list == nil {
+			continue
+		}
+		for _, args := range txs {
+			if violation := list.violation(scope, args); violation != "" {
+				violations = append(violations, violation)
+			}
+		}
+	}
+	return violations, nil
+}
@@ -0,0 +1,53 @@
+package guardian
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// AuditEvent : A sensitive operation recorded in plugin storage, readable by admins under audit/.
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	// Actor is the display name of the token which made the request.
+	Actor    string `json:"actor"`
+	Username string `json:"username"`
+	Address  string `json:"address,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+const auditStoragePrefix = "audit/"
+
+// recordAuditEvent : Stores the event under a time-ordered ID, which is returned
+func (b *backend) recordAuditEvent(ctx context.Context, req *logical.Request, event *AuditEvent) (string, error) {
+	event.Time = time.Now().UTC()
+	event.Actor = req.DisplayName
+	id := fmt.Sprintf("%020d", event.Time.UnixNano())
+	entry, err := logical.StorageEntryJSON(auditStoragePrefix+id, event)
+	if err != nil {
+		return "", err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return "", err
+	}
+	b.Logger().Info("guardian audit event", "id", id, "operation", event.Operation, "actor", event.Actor, "username", event.Username, "address", event.Address)
+	return id, nil
+}
+
+func (b *backend) readAuditEvent(ctx context.Context, s logical.Storage, id string) (*AuditEvent, error) {
+	entry, err := s.Get(ctx, auditStoragePrefix+id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var event AuditEvent
+	if err := entry.DecodeJSON(&event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
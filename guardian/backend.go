@@ -3,7 +3,9 @@ package guardian
 import (
 	"context"
 	"fmt"
+	"sync"
 
+	"github.com/hashicorp/vault/helper/locksutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -19,6 +21,8 @@ func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend,
 
 func Backend(c *logical.BackendConfig) *backend {
 	var b backend
+	b.nonceLocks = locksutil.CreateLocks()
+	b.keyLocks = locksutil.CreateLocks()
 	b.Backend = &framework.Backend{
 		Help:         "",
 		PathsSpecial: &logical.Paths{Unauthenticated: []string{"login"}},
@@ -57,12 +61,33 @@ func Backend(c *logical.BackendConfig) *backend {
 						Type:        framework.TypeString,
 						Description: "Permissioned API token from Okta organization.",
 					},
+					"export_enabled": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: "Allow admins to export users' keys as encrypted keystore files.  Disabled by default.",
+					},
+					"refuse_raw_signing": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: "Refuse raw hashes on sign and sign-batch for every user, so call policies cannot be bypassed.  Off by default.",
+					},
 				},
 				Callbacks: map[logical.Operation]framework.OperationFunc{
 					logical.CreateOperation: b.pathAuthorize,
 					logical.UpdateOperation: b.pathAuthorize,
 				},
 			},
+			&framework.Path{
+				Pattern: "migrate-keys",
+				Fields: map[string]*framework.FieldSchema{
+					"delete_source": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: "Delete each /keys/<username> secret once it has been imported into plugin storage.",
+						Default:     false,
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.pathMigrateKeys,
+				},
+			},
 			&framework.Path{
 				Pattern: "sign",
 				Fields: map[string]*framework.FieldSchema{
@@ -72,7 +97,16 @@ func Backend(c *logical.BackendConfig) *backend {
 					},
 					"address_index": &framework.FieldSchema{
 						Type:        framework.TypeInt,
-						Description: "Integer index of which generated address to use.",
+						Description: "Integer index of which generated address to use, derived along m/44'/60'/0'/0/<address_index>.",
+						Default:     0,
+					},
+					"key_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of one of your keys under keys/ to sign with, instead of an address_index.",
+					},
+					"address_count": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "On read, list this many generated addresses starting from index 0 rather than returning one.",
 						Default:     0,
 					},
 				},
@@ -82,49 +116,719 @@ func Backend(c *logical.BackendConfig) *backend {
 					logical.ReadOperation:   b.pathGetAddress,
 				},
 			},
+			&framework.Path{
+				Pattern: "sign-message",
+				Fields: map[string]*framework.FieldSchema{
+					"message": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Message to sign with the personal_sign prefix.",
+					},
+					"encoding": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "How message is encoded, either utf8 or hex (0x is optional).",
+						Default:     "utf8",
+					},
+					"address_index": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Integer index of which generated address to use, derived along m/44'/60'/0'/0/<address_index>.",
+						Default:     0,
+					},
+					"key_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of one of your keys under keys/ to sign with, instead of an address_index.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathSignMessage,
+					logical.UpdateOperation: b.pathSignMessage,
+				},
+			},
+			&framework.Path{
+				Pattern: "sign-typed-data",
+				Fields: map[string]*framework.FieldSchema{
+					"typed_data": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "EIP-712 JSON holding types, primaryType, domain and message, as given to eth_signTypedData_v4.",
+					},
+					"address_index": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Integer index of which generated address to use, derived along m/44'/60'/0'/0/<address_index>.",
+						Default:     0,
+					},
+					"key_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of one of your keys under keys/ to sign with, instead of an address_index.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathSignTypedData,
+					logical.UpdateOperation: b.pathSignTypedData,
+				},
+			},
+			&framework.Path{
+				Pattern: "sign-contract-call",
+				Fields: withTxFields(map[string]*framework.FieldSchema{
+					"abi": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Contract ABI JSON, instead of an abi_name.",
+					},
+					"abi_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of an ABI stored under abis/, instead of the abi itself.",
+					},
+					"method": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of the contract method to call.",
+					},
+					"args": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "JSON array of the method's arguments.  Integers may be numbers or strings, bytes are 0x prefixed hex.",
+					},
+					"address_index": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Integer index of which generated address to use, derived along m/44'/60'/0'/0/<address_index>.",
+						Default:     0,
+					},
+					"key_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of one of your keys under keys/ to sign with, instead of an address_index.",
+					},
+				}),
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathSignContractCall,
+					logical.UpdateOperation: b.pathSignContractCall,
+				},
+			},
+			&framework.Path{
+				Pattern: "abis/?$",
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.pathListABIs,
+				},
+			},
+			&framework.Path{
+				Pattern: "abis/" + framework.GenericNameRegex("name"),
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name to store the ABI under.",
+					},
+					"abi": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Contract ABI JSON.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathWriteABI,
+					logical.UpdateOperation: b.pathWriteABI,
+					logical.ReadOperation:   b.pathReadABI,
+					logical.DeleteOperation: b.pathDeleteABI,
+				},
+			},
+			&framework.Path{
+				Pattern: "sign-batch",
+				Fields: map[string]*framework.FieldSchema{
+					"items": &framework.FieldSchema{
+						Type:        framework.TypeSlice,
+						Description: "Ordered list of objects, each either {\"raw_data\": <32 byte hash>} or the transaction parameters accepted by sign-tx, including contract deployments.",
+					},
+					"address_index": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Integer index of which generated address to use, derived along m/44'/60'/0'/0/<address_index>.",
+						Default:     0,
+					},
+					"key_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of one of your keys under keys/ to sign with, instead of an address_index.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathSignBatch,
+					logical.UpdateOperation: b.pathSignBatch,
+				},
+			},
+			&framework.Path{
+				Pattern: "verify",
+				Fields: map[string]*framework.FieldSchema{
+					"signature": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Hex signature to verify, r and s followed by v, 0x is optional.",
+					},
+					"hash": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "32 byte hex hash which was signed, as with sign.",
+					},
+					"message": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Message which was signed with the personal_sign prefix, as with sign-message.",
+					},
+					"encoding": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "How message is encoded, either utf8 or hex (0x is optional).",
+						Default:     "utf8",
+					},
+					"typed_data": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "EIP-712 JSON which was signed, as with sign-typed-data.",
+					},
+					"address": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Address the signature is expected to come from.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathVerify,
+					logical.UpdateOperation: b.pathVerify,
+				},
+			},
 			&framework.Path{
 				Pattern: "sign-tx",
+				Fields: withTxFields(withDeployFields(map[string]*framework.FieldSchema{
+					"broadcast": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: "Also submit the signed transaction with eth_sendRawTransaction, through its chain's rpc_url.",
+						Default:     false,
+					},
+					"private": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: "Sign a Quorum private transaction, with a v of 37 or 38, for eth_sendRawPrivateTransaction.",
+						Default:     false,
+					},
+					"private_payload_hash": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "When private, the hash (base64 or 0x hex) the transaction manager returned for the stored payload, which becomes the data.",
+					},
+					"address_index": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Positive integer index of which generated address to use, derived along m/44'/60'/0'/0/<address_index>.",
+						Default:     0,
+					},
+					"key_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of one of your keys under keys/ to sign with, instead of an address_index.",
+					},
+					"address_count": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "On read, list this many generated addresses starting from index 0 rather than returning one.",
+						Default:     0,
+					},
+				})),
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathSignTx,
+					logical.UpdateOperation: b.pathSignTx,
+					logical.ReadOperation:   b.pathGetAddress,
+				},
+			},
+			&framework.Path{
+				Pattern: "preview-tx",
+				Fields: withTxFields(withDeployFields(map[string]*framework.FieldSchema{
+					"private": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: "Preview a Quorum private transaction, as with sign-tx.",
+						Default:     false,
+					},
+					"private_payload_hash": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "When private, the hash the transaction manager returned for the stored payload.",
+					},
+					"tx_rlp": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "An unsigned transaction as sign-raw-tx takes it, instead of the sign-tx fields.",
+					},
+					"tx_json": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "An unsigned transaction in geth's JSON format, as sign-raw-tx takes it.",
+					},
+					"abi": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "ABI JSON to decode the calldata with, otherwise the stored ABIs are searched for its method.",
+					},
+					"abi_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of a stored ABI under abis/ to decode the calldata with.",
+					},
+					"address_index": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Positive integer index of which generated address would sign.",
+						Default:     0,
+					},
+					"key_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of one of your keys under keys/ which would sign, instead of an address_index.",
+					},
+				})),
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathPreviewTx,
+					logical.UpdateOperation: b.pathPreviewTx,
+				},
+			},
+			&framework.Path{
+				Pattern: "sign-raw-tx",
 				Fields: map[string]*framework.FieldSchema{
-					"nonce": &framework.FieldSchema{
+					"broadcast": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: "Also submit the signed transaction with eth_sendRawTransaction, through its chain's rpc_url.",
+						Default:     false,
+					},
+					"tx_rlp": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Hex string (0x optional) of an unsigned transaction: a legacy RLP list of 6 fields, or 9 with the EIP-155 chain ID, or an EIP-2930/EIP-1559 envelope without its signature.",
+					},
+					"tx_json": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "An unsigned transaction in geth's JSON format, instead of tx_rlp.",
+					},
+					"chain": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of the chain under chains/ to sign for, instead of a chain_id.",
+					},
+					"chain_id": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Positive integer chainID of a registered chain, required unless chain is given or the transaction encodes one, which it must then match.",
+					},
+					"address_index": &framework.FieldSchema{
 						Type:        framework.TypeInt,
-						Description: "TxParam: nonce is an unsigned 64-bit integer",
+						Description: "Positive integer index of which generated address to use, derived along m/44'/60'/0'/0/<address_index>.",
+						Default:     0,
 					},
-					"to": &framework.FieldSchema{
+					"key_name": &framework.FieldSchema{
 						Type:        framework.TypeString,
-						Description: "TxParam: to should be an address, must begin with 0x.",
+						Description: "Name of one of your keys under keys/ to sign with, instead of an address_index.",
 					},
-					"amount": &framework.FieldSchema{
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathSignRawTx,
+					logical.UpdateOperation: b.pathSignRawTx,
+				},
+			},
+			&framework.Path{
+				Pattern: "broadcast",
+				Fields: map[string]*framework.FieldSchema{
+					"signed_tx": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Hex string (0x optional) of a signed transaction, as signed_tx_rlp holds it.",
+					},
+					"chain": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of the chain under chains/ to submit it to.",
+					},
+					"chain_id": &framework.FieldSchema{
 						Type:        framework.TypeInt,
-						Description: "TxParam: if this tx transfers value, amount should be an unsigned 64-bit integer.  Unit is wei.",
+						Description: "Positive integer chainID of a registered chain, instead of its name.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathBroadcast,
+					logical.UpdateOperation: b.pathBroadcast,
+				},
+			},
+			&framework.Path{
+				Pattern: "keys/?$",
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.pathListKeys,
+				},
+			},
+			&framework.Path{
+				Pattern: "keys/" + framework.GenericNameRegex("name"),
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of the key, unique among your own keys.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathCreateKey,
+					logical.UpdateOperation: b.pathCreateKey,
+					logical.ReadOperation:   b.pathReadKey,
+					logical.DeleteOperation: b.pathArchiveKey,
+				},
+			},
+			&framework.Path{
+				Pattern: "keys/" + framework.GenericNameRegex("name") + "/import",
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name to store the imported key under, unique among your own keys.",
+					},
+					"private_key": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Raw secp256k1 private key as hex, 0x is optional.",
+					},
+					"keystore_json": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Web3 Secret Storage (keystore v3) JSON holding the key, instead of private_key.",
+					},
+					"passphrase": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Passphrase which decrypts keystore_json.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathImportKey,
+					logical.UpdateOperation: b.pathImportKey,
+				},
+			},
+			&framework.Path{
+				Pattern: "export",
+				Fields: map[string]*framework.FieldSchema{
+					"username": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Okta username of the user whose key should be exported.",
+					},
+					"key_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of the user's key to export, instead of an address_index.",
+					},
+					"address_index": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Index of the user's generated address to export.",
 						Default:     0,
 					},
-					"gas_limit": &framework.FieldSchema{
+					"passphrase": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Passphrase which the keystore file will be encrypted under.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.pathExportKey,
+				},
+			},
+			&framework.Path{
+				Pattern: "audit/?$",
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.pathListAuditEvents,
+				},
+			},
+			&framework.Path{
+				Pattern: "audit/" + framework.GenericNameRegex("id"),
+				Fields: map[string]*framework.FieldSchema{
+					"id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "ID of the audit event.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.pathReadAuditEvent,
+				},
+			},
+			&framework.Path{
+				Pattern: "rotate",
+				Fields: map[string]*framework.FieldSchema{
+					"key_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of one of your keys under keys/ to rotate, rather than your HD wallet.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathRotateKey,
+					logical.UpdateOperation: b.pathRotateKey,
+				},
+			},
+			&framework.Path{
+				Pattern: "versions",
+				Fields: map[string]*framework.FieldSchema{
+					"key_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of one of your keys under keys/ to list versions of, rather than your HD wallet.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.pathKeyVersions,
+				},
+			},
+			&framework.Path{
+				Pattern: "sweep",
+				Fields: withTxFields(map[string]*framework.FieldSchema{
+					"username": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Okta username of the user whose archived key should sign.",
+					},
+					"key_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of the user's key to sign with, instead of an address_index.",
+					},
+					"address_index": &framework.FieldSchema{
 						Type:        framework.TypeInt,
-						Description: "TxParam: gas_limit should be an unsigned 64-bit integer",
+						Description: "Index of the generated address to sign with.",
+						Default:     0,
 					},
-					"gas_price": &framework.FieldSchema{
+					"key_version": &framework.FieldSchema{
 						Type:        framework.TypeInt,
-						Description: "TxParam: gas_price should be a positive 64-bit integer.",
+						Description: "Version of the wallet or named key to sign with, including archived versions.",
 					},
-					"data": &framework.FieldSchema{
+				}),
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.pathSweep,
+				},
+			},
+			&framework.Path{
+				Pattern: "master-key/rotate",
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.pathRotateMasterKey,
+				},
+			},
+			&framework.Path{
+				Pattern: "master-key/rewrap",
+				Fields: map[string]*framework.FieldSchema{
+					"delete_old_versions": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: "Once every key is rewrapped, drop master key versions older than the latest.",
+						Default:     false,
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.pathRewrapKeys,
+				},
+			},
+			&framework.Path{
+				Pattern: "backup",
+				Fields: map[string]*framework.FieldSchema{
+					"username": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Okta username to back up, leave empty to back up every user.",
+					},
+					"shares": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Number of Shamir shares to split the backup key into.",
+						Default:     5,
+					},
+					"threshold": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Number of shares required to restore the backup.",
+						Default:     3,
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.pathBackup,
+				},
+			},
+			&framework.Path{
+				Pattern: "restore",
+				Fields: map[string]*framework.FieldSchema{
+					"bundle": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Backup bundle returned by the backup path.",
+					},
+					"shares": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: "Hex encoded Shamir shares of the backup key, at least as many as its threshold.",
+					},
+					"overwrite": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: "Replace keys already in storage, rather than skipping them.",
+						Default:     false,
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.pathRestore,
+				},
+			},
+			&framework.Path{
+				Pattern: "nonce(/(?P<action>reserve|release|sync))?$",
+				Fields: map[string]*framework.FieldSchema{
+					"action": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "reserve, release or sync, leave empty to read the nonce state.",
+					},
+					"chain": &framework.FieldSchema{
 						Type:        framework.TypeString,
-						Description: "TxParam: data should either be a hex string (0x optional) or not specified.",
+						Description: "Name of the chain under chains/ the nonces are for.",
 					},
 					"chain_id": &framework.FieldSchema{
 						Type:        framework.TypeInt,
-						Description: "Positive integer chainID for your desired network.",
-						Default:     1,
+						Description: "Positive integer chainID of a registered chain, instead of its name.",
 					},
 					"address_index": &framework.FieldSchema{
 						Type:        framework.TypeInt,
-						Description: "Positive integer index of which generated address to use.",
+						Description: "Integer index of which generated address to use, derived along m/44'/60'/0'/0/<address_index>.",
 						Default:     0,
 					},
+					"key_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name of one of your keys under keys/ to use, instead of an address_index.",
+					},
+					"count": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Number of consecutive nonces to reserve.",
+						Default:     1,
+					},
+					"nonce": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Nonce to release, which will be handed out again before any new one.",
+					},
 				},
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.CreateOperation: b.pathSignTx,
-					logical.UpdateOperation: b.pathSignTx,
-					logical.ReadOperation:   b.pathGetAddress,
+					logical.ReadOperation:   b.pathNonce,
+					logical.UpdateOperation: b.pathNonce,
+				},
+			},
+			&framework.Path{
+				Pattern: "limits/(?P<kind>users|groups)/?$",
+				Fields: map[string]*framework.FieldSchema{
+					"kind": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "users or groups.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.pathListSpendingLimits,
+				},
+			},
+			&framework.Path{
+				Pattern: "limits/(?P<kind>users|groups)/(?P<name>[^/]+)",
+				Fields: map[string]*framework.FieldSchema{
+					"kind": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "users for an Okta username, groups for an Okta group name.",
+					},
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Okta username or group name the limit applies to.",
+					},
+					"per_tx": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Most value one transaction may send, given like amount.  Empty for no limit.",
+					},
+					"daily": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Most value which may be sent over any 24 hours, given like amount.  Empty for no limit.",
+					},
+					"monthly": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Most value which may be sent over any 30 days, given like amount.  Empty for no limit.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathWriteSpendingLimit,
+					logical.UpdateOperation: b.pathWriteSpendingLimit,
+					logical.ReadOperation:   b.pathReadSpendingLimit,
+					logical.DeleteOperation: b.pathDeleteSpendingLimit,
+				},
+			},
+			&framework.Path{
+				Pattern: "addresses/(?P<kind>users|groups)/?$",
+				Fields: map[string]*framework.FieldSchema{
+					"kind": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "users or groups.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.pathListAddressLists,
+				},
+			},
+			&framework.Path{
+				Pattern: "addresses/(?P<scope>global|users/[^/]+|groups/[^/]+)",
+				Fields: map[string]*framework.FieldSchema{
+					"scope": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "global, users/<Okta username> or groups/<Okta group name>.",
+					},
+					"mode": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "allowlist to only allow listed recipients, denylist to refuse them, or value_allowlist to only hold transactions which send value to the allowlist.  Required for a new list.",
+					},
+					"addresses": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "JSON object of 0x addresses to their labels, replacing those listed.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathWriteAddressList,
+					logical.UpdateOperation: b.pathWriteAddressList,
+					logical.ReadOperation:   b.pathReadAddressList,
+					logical.DeleteOperation: b.pathDeleteAddressList,
+				},
+			},
+			&framework.Path{
+				Pattern: "addresses/(?P<scope>global|users/[^/]+|groups/[^/]+)/(?P<address>0x[0-9a-fA-F]{40})",
+				Fields: map[string]*framework.FieldSchema{
+					"scope": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "global, users/<Okta username> or groups/<Okta group name>.",
+					},
+					"address": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "0x address to add to or remove from the list.",
+					},
+					"label": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "What the address is, shown when a transaction is refused over it.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathWriteListedAddress,
+					logical.UpdateOperation: b.pathWriteListedAddress,
+					logical.DeleteOperation: b.pathDeleteListedAddress,
+				},
+			},
+			&framework.Path{
+				Pattern: "calls/?$",
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.pathListCallPolicies,
+				},
+			},
+			&framework.Path{
+				Pattern: "calls/(?P<contract>any|0x[0-9a-fA-F]{40})",
+				Fields: map[string]*framework.FieldSchema{
+					"contract": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "0x address of the contract, or any for a policy on every contract.",
+					},
+					"mode": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "allowlist to only allow the methods with rules, subject to their constraints, or denylist to refuse them.  Required for a new policy.",
+					},
+					"rules": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "JSON object of methods, as 0x selectors or signatures like approve(address,uint256), to their rules, replacing the current ones.  A rule may give the abi_name of a stored ABI and constraints on its arguments, each with an arg and one_of or max.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathWriteCallPolicy,
+					logical.UpdateOperation: b.pathWriteCallPolicy,
+					logical.ReadOperation:   b.pathReadCallPolicy,
+					logical.DeleteOperation: b.pathDeleteCallPolicy,
+				},
+			},
+			&framework.Path{
+				Pattern: "chains/?$",
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.pathListChains,
+				},
+			},
+			&framework.Path{
+				Pattern: "chains/" + framework.GenericNameRegex("name"),
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Name callers pass as chain, like eximchain-testnet.",
+					},
+					"chain_id": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Positive integer chainID of the network, required when registering it.",
+					},
+					"rpc_url": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "http:// or https:// URL of a JSON-RPC node on the chain, used to sync nonces and broadcast.",
+					},
+					"default_gas_limit": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "gas_limit for transactions which leave it out, 0 to require one.",
+					},
+					"max_gas_price": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Highest gas_price, or max_fee_per_gas, which may be signed for, given like gas_price.  Empty for no limit.",
+					},
+					"enabled": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: "Whether transactions may be signed for the chain.  New chains are enabled unless this is false.",
+					},
+				},
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.CreateOperation: b.pathWriteChain,
+					logical.UpdateOperation: b.pathWriteChain,
+					logical.ReadOperation:   b.pathReadChain,
+					logical.DeleteOperation: b.pathDeleteChain,
 				},
 			},
 		}),
@@ -135,6 +839,15 @@ func Backend(c *logical.BackendConfig) *backend {
 
 type backend struct {
 	*framework.Backend
+	// nonceLocks serialize changes to the nonces handed out for each address and chain, so concurrent signers never share one
+	nonceLocks []*locksutil.LockEntry
+	// keyLocks serialize checking a key's name or address is free with storing the key there
+	keyLocks []*locksutil.LockEntry
+	// spendingLock serializes spending limit checks with recording what was spent
+	spendingLock sync.Mutex
+	// configLock is held to write the config or rotate and rewrap under the master key, and read held
+	// while sealing key material, so a rewrap never deletes the master key version a new key was sealed under
+	configLock sync.RWMutex
 }
 
 func (b *backend) Config(ctx context.Context, s logical.Storage) (*Config, error) {
@@ -148,11 +861,19 @@ func (b *backend) Config(ctx context.Context, s logical.Storage) (*Config, error
 			return nil, err
 		}
 	} else {
-		result = Config{"", "", ""}
+		result = Config{}
 	}
 	return &result, nil
 }
 
+func (b *backend) writeConfig(ctx context.Context, s logical.Storage, cfg *Config) error {
+	entry, err := logical.StorageEntryJSON("config", cfg)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
 func (b *backend) pathExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
 	out, err := req.Storage.Get(ctx, req.Path)
 	if err != nil {
@@ -161,3 +882,71 @@ func (b *backend) pathExistenceCheck(ctx context.Context, req *logical.Request,
 
 	return out != nil, nil
 }
+
+// withTxFields : Adds the transaction parameters shared by every path which builds a transaction.
+func withTxFields(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["nonce"] = &framework.FieldSchema{
+		Type:        framework.TypeInt,
+		Description: "TxParam: nonce is an unsigned 64-bit integer, leave it out to be assigned the next one Guardian tracks for the address and chain.",
+	}
+	fields["to"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "TxParam: to should be an address, must begin with 0x.",
+	}
+	fields["amount"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "TxParam: if this tx transfers value, amount should be a decimal or 0x hex integer up to 2^256-1.  Unit is wei unless suffixed with gwei or ether.",
+		Default:     "0",
+	}
+	fields["gas_limit"] = &framework.FieldSchema{
+		Type:        framework.TypeInt,
+		Description: "TxParam: gas_limit should be an unsigned 64-bit integer, defaulting to the chain's default_gas_limit",
+	}
+	fields["gas_price"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "TxParam: gas_price should be a decimal or 0x hex integer up to 2^256-1.  Unit is wei unless suffixed with gwei or ether.",
+	}
+	fields["data"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "TxParam: data should either be a hex string (0x optional) or not specified.",
+	}
+	fields["chain"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Name of the chain under chains/ to sign for, instead of a chain_id.",
+	}
+	fields["chain_id"] = &framework.FieldSchema{
+		Type:        framework.TypeInt,
+		Description: "Positive integer chainID of a registered chain, instead of its name.",
+	}
+	fields["tx_type"] = &framework.FieldSchema{
+		Type:        framework.TypeInt,
+		Description: "TxParam: 0 for a legacy transaction, 1 for an EIP-2930 access list transaction, 2 for an EIP-1559 dynamic fee transaction.",
+		Default:     0,
+	}
+	fields["access_list"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "TxParam: for tx_type 1 or 2, a JSON array of {\"address\", \"storageKeys\"} objects.",
+	}
+	fields["max_fee_per_gas"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "TxParam: for tx_type 2, the most paid per gas including the priority fee, given like gas_price.",
+	}
+	fields["max_priority_fee_per_gas"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "TxParam: for tx_type 2, the tip paid per gas to the block producer, given like gas_price.",
+	}
+	return fields
+}
+
+// withDeployFields : Adds the fields for contract creation transactions, which are sent without a `to`
+func withDeployFields(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["bytecode"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "TxParam: hex string (0x optional) of contract creation bytecode to deploy, in which case `to` must be omitted.",
+	}
+	fields["constructor_args"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "TxParam: hex string (0x optional) of ABI-encoded constructor arguments, appended to `bytecode`.",
+	}
+	return fields
+}
@@ -0,0 +1,169 @@
+package guardian
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	uuid "github.com/hashicorp/go-uuid"
+)
+
+// backupBundle : The encrypted backup handed to admins, its key exists only as Shamir shares.
+type backupBundle struct {
+	Version    int       `json:"version"`
+	CreatedAt  time.Time `json:"created_at"`
+	Threshold  int       `json:"threshold"`
+	Ciphertext []byte    `json:"ciphertext"`
+}
+
+// backupContents : Wallets and named keys by username, with their key material decrypted
+// so they can be restored without the master key that sealed them.
+type backupContents struct {
+	Wallets   map[string]*Wallet              `json:"wallets"`
+	NamedKeys map[string]map[string]*NamedKey `json:"named_keys"`
+}
+
+const backupBundleVersion = 1
+
+func newBackupContents() *backupContents {
+	return &backupContents{Wallets: map[string]*Wallet{}, NamedKeys: map[string]map[string]*NamedKey{}}
+}
+
+// sealBackup : Encrypts the contents under a fresh key, returning the encoded bundle and the key's shares.
+func sealBackup(contents *backupContents, parts, threshold int) (bundle string, shares [][]byte, err error) {
+	backupKey, err := uuid.GenerateRandomBytes(envelopeKeySize)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zeroBytes(backupKey)
+	shares, err = SplitSecret(backupKey, parts, threshold)
+	if err != nil {
+		return "", nil, err
+	}
+	plaintext, err := json.Marshal(contents)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zeroBytes(plaintext)
+	ciphertext, err := aesGCMSeal(backupKey, plaintext)
+	if err != nil {
+		return "", nil, err
+	}
+	bundleJSON, err := json.Marshal(backupBundle{
+		Version:    backupBundleVersion,
+		CreatedAt:  time.Now().UTC(),
+		Threshold:  threshold,
+		Ciphertext: ciphertext,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return base64.StdEncoding.EncodeToString(bundleJSON), shares, nil
+}
+
+// openBackup : Rebuilds the backup key from the shares and decrypts the bundle.
+func openBackup(bundle string, shares [][]byte) (*backupContents, error) {
+	bundleJSON, err := base64.StdEncoding.DecodeString(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("bundle is not valid base64: %v", err)
+	}
+	var sealed backupBundle
+	if err := json.Unmarshal(bundleJSON, &sealed); err != nil {
+		return nil, fmt.Errorf("bundle is not valid: %v", err)
+	}
+	if sealed.Version != backupBundleVersion {
+		return nil, fmt.Errorf("bundle version %d is not supported", sealed.Version)
+	}
+	if len(shares) < sealed.Threshold {
+		return nil, fmt.Errorf("this bundle needs %d shares, only %d were given", sealed.Threshold, len(shares))
+	}
+	backupKey, err := CombineShares(shares)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(backupKey)
+	if len(backupKey) != envelopeKeySize {
+		return nil, errors.New("shares do not belong to a backup key")
+	}
+	plaintext, err := aesGCMOpen(backupKey, sealed.Ciphertext)
+	if err != nil {
+		return nil, errors.New("unable to decrypt the bundle, the shares do not match it")
+	}
+	defer zeroBytes(plaintext)
+	contents := newBackupContents()
+	if err := json.Unmarshal(plaintext, contents); err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+// unsealed : Returns a copy of the material with its secrets decrypted into the plaintext fields.
+func (m *KeyMaterial) unsealed(cfg *Config) (KeyMaterial, error) {
+	var plain KeyMaterial
+	if m.IsHD() {
+		err := m.withMnemonic(cfg, func(mnemonic string) error {
+			plain.Mnemonic = mnemonic
+			return nil
+		})
+		return plain, err
+	}
+	err := m.withKeyHex(cfg, 0, func(privKeyHex string) error {
+		plain.PrivKeyHex = privKeyHex
+		return nil
+	})
+	return plain, err
+}
+
+// unsealed : Returns a copy of the wallet, including archived versions, with its key material decrypted.
+func (w *Wallet) unsealed(cfg *Config) (*Wallet, error) {
+	plain := *w
+	var err error
+	if plain.KeyMaterial, err = w.KeyMaterial.unsealed(cfg); err != nil {
+		return nil, err
+	}
+	plain.ArchivedVersions, err = unsealedArchivedKeys(cfg, w.ArchivedVersions)
+	if err != nil {
+		return nil, err
+	}
+	return &plain, nil
+}
+
+// unsealed : Returns a copy of the key, including archived versions, with its key material decrypted.
+func (k *NamedKey) unsealed(cfg *Config) (*NamedKey, error) {
+	plain := *k
+	var err error
+	if plain.KeyMaterial, err = k.KeyMaterial.unsealed(cfg); err != nil {
+		return nil, err
+	}
+	plain.ArchivedVersions, err = unsealedArchivedKeys(cfg, k.ArchivedVersions)
+	if err != nil {
+		return nil, err
+	}
+	return &plain, nil
+}
+
+func unsealedArchivedKeys(cfg *Config, archived []ArchivedKey) ([]ArchivedKey, error) {
+	if archived == nil {
+		return nil, nil
+	}
+	plain := make([]ArchivedKey, len(archived))
+	for i, version := range archived {
+		plain[i] = version
+		material, err := version.KeyMaterial.unsealed(cfg)
+		if err != nil {
+			return nil, err
+		}
+		plain[i].KeyMaterial = material
+	}
+	return plain, nil
+}
+
+func archivedAddresses(archived []ArchivedKey) []string {
+	pubAddresses := make([]string, len(archived))
+	for i, version := range archived {
+		pubAddresses[i] = version.PublicAddressHex
+	}
+	return pubAddresses
+}
@@ -0,0 +1,127 @@
+package guardian
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// testStorage : Fresh storage holding a config with a master key, as authorize leaves it
+func testStorage(t *testing.T, b *backend) (logical.Storage, *Config) {
+	s := &logical.InmemStorage{}
+	cfg := &Config{}
+	if err := cfg.RotateMasterKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.writeConfig(context.Background(), s, cfg); err != nil {
+		t.Fatal(err)
+	}
+	return s, cfg
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	b := Backend(&logical.BackendConfig{})
+	s, cfg := testStorage(t, b)
+
+	// alice has a rotated wallet, bob only a named key
+	wallet, err := NewWallet(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wallet.Rotate(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.writeWallet(ctx, s, "alice", wallet); err != nil {
+		t.Fatal(err)
+	}
+	privKeyHex, pubAddress, err := CreateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewNamedKey(cfg, privKeyHex, pubAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.writeNamedKey(ctx, s, "bob", "payroll", key); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "backup",
+		Storage:   s,
+		Data:      map[string]interface{}{"shares": 3, "threshold": 2},
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("backup: %v %v", resp, err)
+	}
+	if resp.Data["wallets"] != 1 || resp.Data["named_keys"] != 1 {
+		t.Fatalf("backed up %v wallets and %v named keys, want 1 and 1", resp.Data["wallets"], resp.Data["named_keys"])
+	}
+	bundle := resp.Data["bundle"].(string)
+	shares := resp.Data["shares"].([]string)
+
+	// Restore into storage sealed under a different master key
+	restoreStorage, restoreCfg := testStorage(t, b)
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "restore",
+		Storage:   restoreStorage,
+		Data:      map[string]interface{}{"bundle": bundle, "shares": shares[1:]},
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("restore: %v %v", resp, err)
+	}
+
+	restoredWallet, err := b.readWallet(ctx, restoreStorage, "alice")
+	if err != nil || restoredWallet == nil {
+		t.Fatalf("alice's wallet was not restored: %v", err)
+	}
+	if restoredWallet.Version() != 2 || restoredWallet.PublicAddressHex != wallet.PublicAddressHex {
+		t.Errorf("restored wallet is version %d at %s, want version 2 at %s", restoredWallet.Version(), restoredWallet.PublicAddressHex, wallet.PublicAddressHex)
+	}
+	for version := 1; version <= wallet.Version(); version++ {
+		original, _ := wallet.AtVersion(version)
+		restored, _ := restoredWallet.AtVersion(version)
+		want, err := original.Addresses(cfg, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := restored.Addresses(restoreCfg, 3)
+		if err != nil {
+			t.Fatalf("version %d does not open under the new master key: %v", version, err)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("version %d address %d is %s, want %s", version, i, got[i], want[i])
+			}
+		}
+	}
+
+	restoredKey, err := b.readNamedKey(ctx, restoreStorage, "bob", "payroll")
+	if err != nil || restoredKey == nil {
+		t.Fatalf("bob's payroll key was not restored: %v", err)
+	}
+	err = restoredKey.withKeyHex(restoreCfg, 0, func(restoredHex string) error {
+		if restoredHex != privKeyHex {
+			t.Errorf("restored key is %s, want %s", restoredHex, privKeyHex)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One share is below the threshold
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "restore",
+		Storage:   restoreStorage,
+		Data:      map[string]interface{}{"bundle": bundle, "shares": shares[:1], "overwrite": true},
+	})
+	if err == nil && !resp.IsError() {
+		t.Error("restored from a single share")
+	}
+}
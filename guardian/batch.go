@@ -0,0 +1,157 @@
+package guardian
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// maxBatchSize : Upper bound on the number of items one sign-batch request may sign
+const maxBatchSize = 100
+
+// batchItem : One entry of a sign-batch request, either a 32 byte hash or a transaction.
+type batchItem struct {
+	Hash []byte
+	Tx   *txArgs
+}
+
+// batchItemsFromData : Parses and validates every item up front, so nothing is signed if any item is malformed.
+func batchItemsFromData(data *framework.FieldData) ([]batchItem, error) {
+	rawItems := data.Get("items").([]interface{})
+	if len(rawItems) == 0 || len(rawItems) > maxBatchSize {
+		return nil, fmt.Errorf("items must hold between 1 and %d entries", maxBatchSize)
+	}
+
+	items := make([]batchItem, len(rawItems))
+	for i, rawItem := range rawItems {
+		fields, ok := rawItem.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("item %d must be an object", i)
+		}
+		item, err := batchItemFromFields(fields)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %v", i, err)
+		}
+		items[i] = *item
+	}
+	return items, nil
+}
+
+func batchItemFromFields(fields map[string]interface{}) (*batchItem, error) {
+	if rawData, isHash := fields["raw_data"]; isHash {
+		if len(fields) != 1 {
+			return nil, errors.New("a hash item holds only raw_data")
+		}
+		rawDataStr, ok := rawData.(string)
+		if !ok {
+			return nil, errors.New("raw_data must be a hex string")
+		}
+		hash, err := hex.DecodeString(strings.TrimPrefix(rawDataStr, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode raw_data string from hex to bytes: %v", err)
+		}
+		if len(hash) != 32 {
+			return nil, errors.New("raw_data must be 32 bytes")
+		}
+		return &batchItem{Hash: hash}, nil
+	}
+
+	txData := &framework.FieldData{Raw: fields, Schema: withTxFields(withDeployFields(map[string]*framework.FieldSchema{}))}
+	for name := range fields {
+		if _, known := txData.Schema[name]; !known {
+			return nil, fmt.Errorf("unknown field %s", name)
+		}
+	}
+	if err := txData.Validate(); err != nil {
+		return nil, err
+	}
+	args, err := txArgsFromData(txData)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := hex.DecodeString(args.Data); err != nil {
+		return nil, fmt.Errorf("data is not valid hex: %v", err)
+	}
+	return &batchItem{Tx: args}, nil
+}
+
+// SignBatch : Signs every item in order, decrypting the private key once for the whole batch.
+// Results are only returned if every item signs, and deployments include their contract_address.
+func (k *SigningKey) SignBatch(items []batchItem) (results []map[string]interface{}, err error) {
+	err = k.material.withKeyHex(k.cfg, k.addressIndex, func(privKeyHex string) error {
+		results = make([]map[string]interface{}, len(items))
+		// Deployments report the address their contract will have, which needs the sender's address
+		var sender string
+		for i, item := range items {
+			if item.Tx == nil {
+				sig, signErr := SignWithHexKey(item.Hash, privKeyHex)
+				if signErr != nil {
+					return fmt.Errorf("item %d: %v", i, signErr)
+				}
+				results[i] = map[string]interface{}{"signature": "0x" + hex.EncodeToString(sig)}
+				continue
+			}
+			args := item.Tx
+			signedTx, signedRLP, signErr := args.signWithHexKey(privKeyHex)
+			if signErr != nil {
+				return fmt.Errorf("item %d: %v", i, signErr)
+			}
+			results[i] = args.withParsedValues(map[string]interface{}{"signed_tx_json": signedTx, "signed_tx_rlp": signedRLP})
+			if args.To == nil {
+				if sender == "" {
+					if sender, signErr = AddressFromHexKey(privKeyHex); signErr != nil {
+						return fmt.Errorf("item %d: %v", i, signErr)
+					}
+				}
+				results[i]["contract_address"] = args.ContractAddress(sender)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// signBatch : Assigns the batch's transactions their nonces in order, then signs it.
+// If anything fails, the nonces assigned are released again.
+func (b *backend) signBatch(ctx context.Context, s logical.Storage, key *SigningKey, items []batchItem) ([]map[string]interface{}, error) {
+	var pubAddress string
+	var assigned []*txArgs
+	unassign := func(cause error) error {
+		for i := len(assigned) - 1; i >= 0; i-- {
+			if releaseErr := b.unassignNonce(ctx, s, pubAddress, assigned[i]); releaseErr != nil {
+				return fmt.Errorf("%v, and the nonces could not be released: %v", cause, releaseErr)
+			}
+		}
+		return cause
+	}
+
+	for i, item := range items {
+		if item.Tx == nil {
+			continue
+		}
+		if pubAddress == "" {
+			address, err := key.Address()
+			if err != nil {
+				return nil, err
+			}
+			pubAddress = address
+		}
+		if err := b.assignNonce(ctx, s, pubAddress, item.Tx); err != nil {
+			return nil, unassign(fmt.Errorf("item %d: unable to assign a nonce: %v", i, err))
+		}
+		assigned = append(assigned, item.Tx)
+	}
+	results, err := key.SignBatch(items)
+	if err != nil {
+		return nil, unassign(err)
+	}
+	return results, nil
+}
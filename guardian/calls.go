@@ -0,0 +1,339 @@
+package guardian
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/eximchain/go-ethereum/accounts/abi"
+	"github.com/eximchain/go-ethereum/crypto"
+	"github.com/hashicorp/vault/logical"
+)
+
+// CallPolicy : Which methods may be called on one contract, or under calls/any on every contract.
+// In allowlist mode only the methods with rules may be called, in denylist mode those methods may not be.
+type CallPolicy struct {
+	Mode string `json:"mode"`
+	// Rules are keyed by 0x prefixed 4 byte selector
+	Rules map[string]*CallRule `json:"rules"`
+}
+
+// CallRule : What an allowlisted method's arguments must be.  Constraints are checked against the
+// arguments as the stored ABI named by ABIName decodes them.
+type CallRule struct {
+	Signature   string          `json:"signature,omitempty"`
+	ABIName     string          `json:"abi_name,omitempty"`
+	Constraints []ArgConstraint `json:"constraints,omitempty"`
+}
+
+// ArgConstraint : A limit on one argument, named as in the ABI or by its index.  OneOf lists the
+// values it may take, compared case-insensitively so addresses match however they are checksummed,
+// and Max caps an integer argument.
+type ArgConstraint struct {
+	Arg   string   `json:"arg"`
+	OneOf []string `json:"one_of,omitempty"`
+	Max   *big.Int `json:"max,omitempty"`
+}
+
+const (
+	callPolicyStoragePrefix = "calls/"
+	anyContractScope        = "any"
+)
+
+// callRuleInput : A rule as admins write it, with max given like amount
+type callRuleInput struct {
+	ABIName     string `json:"abi_name"`
+	Constraints []struct {
+		Arg   string   `json:"arg"`
+		OneOf []string `json:"one_of"`
+		Max   string   `json:"max"`
+	} `json:"constraints"`
+}
+
+var (
+	methodNameRegex = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$]*$`)
+	abiTypeRegex    = regexp.MustCompile(`^(address|bool|string|function|bytes|bytes([0-9]+)|u?int([0-9]+))((\[[1-9][0-9]*\]|\[\])*)$`)
+)
+
+// canonicalABIType : Whether the type is written as selectors hash it, like uint256 rather than uint.
+// Tuples are not supported, their methods must be given by selector.
+func canonicalABIType(typ string) bool {
+	match := abiTypeRegex.FindStringSubmatch(typ)
+	if match == nil {
+		return false
+	}
+	if size := match[2]; size != "" {
+		n, err := strconv.Atoi(size)
+		return err == nil && size[0] != '0' && n >= 1 && n <= 32
+	}
+	if size := match[3]; size != "" {
+		n, err := strconv.Atoi(size)
+		return err == nil && size[0] != '0' && n >= 8 && n <= 256 && n%8 == 0
+	}
+	return true
+}
+
+// methodSelector : The 0x selector for a method given as its selector or its canonical signature, like
+// transfer(address,uint256).  Signatures which would hash to another method's selector, like
+// transfer(address,uint) or ones with argument names, are refused rather than silently never matching.
+func methodSelector(method string) (selector, signature string, err error) {
+	if strings.HasPrefix(strings.ToLower(method), "0x") {
+		decoded, err := hex.DecodeString(method[2:])
+		if err != nil || len(decoded) != 4 {
+			return "", "", fmt.Errorf("%s is not a 4 byte selector", method)
+		}
+		return "0x" + hex.EncodeToString(decoded), "", nil
+	}
+	open := strings.Index(method, "(")
+	if open < 0 || !strings.HasSuffix(method, ")") {
+		return "", "", fmt.Errorf("%s is neither a 0x selector nor a method signature like transfer(address,uint256)", method)
+	}
+	if !methodNameRegex.MatchString(method[:open]) {
+		return "", "", fmt.Errorf("%s does not start with a valid method name", method)
+	}
+	if params := method[open+1 : len(method)-1]; params != "" {
+		for _, typ := range strings.Split(params, ",") {
+			if !canonicalABIType(typ) {
+				return "", "", fmt.Errorf("%s is not a canonical signature, %q must be a type like uint256 with no spaces or names; give tuple methods by selector", method, typ)
+			}
+		}
+	}
+	return "0x" + hex.EncodeToString(crypto.Keccak256([]byte(method))[:4]), method, nil
+}
+
+// parseCallRules : Decodes the rules JSON admins write, checking every constraint refers to an argument
+// of its method in the stored ABI
+func (b *backend) parseCallRules(ctx context.Context, s logical.Storage, rulesJSON string) (map[string]*CallRule, error) {
+	var inputs map[string]callRuleInput
+	if err := json.Unmarshal([]byte(rulesJSON), &inputs); err != nil {
+		return nil, fmt.Errorf("`rules` must be a JSON object of methods to their rules: %v", err)
+	}
+	rules := map[string]*CallRule{}
+	for method, input := range inputs {
+		selector, signature, err := methodSelector(method)
+		if err != nil {
+			return nil, err
+		}
+		rule := &CallRule{Signature: signature, ABIName: input.ABIName}
+		if input.ABIName == "" && len(input.Constraints) > 0 {
+			return nil, fmt.Errorf("%s has constraints, so needs the `abi_name` of a stored ABI to decode its arguments", method)
+		}
+		if input.ABIName != "" {
+			// The ABI must have the method, which also catches a signature naming the wrong one
+			abiMethod, err := b.storedABIMethod(ctx, s, input.ABIName, selector)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", method, err)
+			}
+			rule.Signature = abiMethod.Sig()
+			for _, constraint := range input.Constraints {
+				if argIndex(abiMethod, constraint.Arg) < 0 {
+					return nil, fmt.Errorf("%s has no argument %s", abiMethod.Sig(), constraint.Arg)
+				}
+				parsed := ArgConstraint{Arg: constraint.Arg, OneOf: constraint.OneOf}
+				if constraint.Max != "" {
+					if parsed.Max, err = parseWei(constraint.Max); err != nil {
+						return nil, fmt.Errorf("%s has an invalid max for %s: %v", method, constraint.Arg, err)
+					}
+				}
+				if parsed.OneOf == nil && parsed.Max == nil {
+					return nil, fmt.Errorf("%s's constraint on %s needs one_of or max", method, constraint.Arg)
+				}
+				rule.Constraints = append(rule.Constraints, parsed)
+			}
+		}
+		rules[selector] = rule
+	}
+	return rules, nil
+}
+
+// storedABIMethod : The method with the selector in the stored ABI
+func (b *backend) storedABIMethod(ctx context.Context, s logical.Storage, abiName, selector string) (*abi.Method, error) {
+	stored, err := b.readStoredABI(ctx, s, abiName)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, fmt.Errorf("no ABI is stored as %s", abiName)
+	}
+	contractABI, err := ParseABI(stored.ABI)
+	if err != nil {
+		return nil, err
+	}
+	selectorBytes, _ := hex.DecodeString(strings.TrimPrefix(selector, "0x"))
+	return contractABI.MethodById(selectorBytes)
+}
+
+// argIndex : The index of the argument, given by name or index, or -1 if the method has no such argument
+func argIndex(method *abi.Method, arg string) int {
+	for i, input := range method.Inputs {
+		if input.Name == arg {
+			return i
+		}
+	}
+	if index, err := strconv.Atoi(arg); err == nil && index >= 0 && index < len(method.Inputs) {
+		return index
+	}
+	return -1
+}
+
+// violation : Describes how the decoded argument value breaks the constraint, or is empty if it doesn't
+func (constraint *ArgConstraint) violation(methodName string, value interface{}) string {
+	str, ok := value.(string)
+	if !ok {
+		if boolean, isBool := value.(bool); isBool {
+			str, ok = strconv.FormatBool(boolean), true
+		}
+	}
+	if !ok {
+		return fmt.Sprintf("%s's %s cannot be constrained, as it is not a single value", methodName, constraint.Arg)
+	}
+	if constraint.OneOf != nil {
+		allowed := false
+		for _, option := range constraint.OneOf {
+			if strings.EqualFold(option, str) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("%s's %s of %s is not one of %s", methodName, constraint.Arg, str, strings.Join(constraint.OneOf, ", "))
+		}
+	}
+	if constraint.Max != nil {
+		number, isNumber := new(big.Int).SetString(str, 10)
+		if !isNumber {
+			return fmt.Sprintf("%s's %s of %s is not an integer", methodName, constraint.Arg, str)
+		}
+		if number.Cmp(constraint.Max) > 0 {
+			return fmt.Sprintf("%s's %s of %s is above the limit of %s", methodName, constraint.Arg, str, constraint.Max)
+		}
+	}
+	return ""
+}
+
+func (b *backend) readCallPolicy(ctx context.Context, s logical.Storage, contract string) (*CallPolicy, error) {
+	entry, err := s.Get(ctx, callPolicyStoragePrefix+strings.ToLower(contract))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var policy CallPolicy
+	if err := entry.DecodeJSON(&policy); err != nil {
+		return nil, err
+	}
+	if policy.Rules == nil {
+		policy.Rules = map[string]*CallRule{}
+	}
+	return &policy, nil
+}
+
+func (b *backend) writeCallPolicy(ctx context.Context, s logical.Storage, contract string, policy *CallPolicy) error {
+	entry, err := logical.StorageEntryJSON(callPolicyStoragePrefix+strings.ToLower(contract), policy)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// callViolations : How the transactions' contract calls break the policies for their contracts and for
+// any contract.  Sending value without calldata is left to the recipient lists.  A private transaction's
+// calldata is held by the transaction manager, so it cannot be checked and is refused wherever a policy applies.
+func (b *backend) callViolations(ctx context.Context, s logical.Storage, txs []*txArgs) ([]string, error) {
+	violations := []string{}
+	for _, args := range txs {
+		if args.To == nil || args.Data == "" {
+			continue
+		}
+		calldata, err := hex.DecodeString(args.Data)
+		if err != nil {
+			return nil, err
+		}
+		for _, contract := range []string{args.To.Hex(), anyContractScope} {
+			policy, err := b.readCallPolicy(ctx, s, contract)
+			if err != nil {
+				return nil, err
+			}
+			if policy == nil {
+				continue
+			}
+			scope := "contract " + args.To.Hex()
+			if contract == anyContractScope {
+				scope = "any contract"
+			}
+			if args.Private {
+				violations = append(violations, fmt.Sprintf("private transactions cannot be checked against the call policy on %s", scope))
+				continue
+			}
+			violation, err := b.callPolicyViolation(ctx, s, policy, scope, calldata)
+			if err != nil {
+				return nil, err
+			}
+			violations = append(violations, violation...)
+		}
+	}
+	return violations, nil
+}
+
+// callPolicyViolation : Describes how the calldata breaks the policy, which applies to the scope
+func (b *backend) callPolicyViolation(ctx context.Context, s logical.Storage, policy *CallPolicy, scope string, calldata []byte) ([]string, error) {
+	if len(calldata) < 4 {
+		if policy.Mode == allowlistMode {
+			return []string{fmt.Sprintf("calldata without a method selector is not allowed on %s", scope)}, nil
+		}
+		return nil, nil
+	}
+	selector := "0x" + hex.EncodeToString(calldata[:4])
+	rule, hasRule := policy.Rules[selector]
+	methodName := selector
+	if hasRule && rule.Signature != "" {
+		methodName = rule.Signature
+	}
+	if policy.Mode == denylistMode {
+		if hasRule {
+			return []string{fmt.Sprintf("%s is denied on %s", methodName, scope)}, nil
+		}
+		return nil, nil
+	}
+	if !hasRule {
+		return []string{fmt.Sprintf("%s is not allowed on %s", methodName, scope)}, nil
+	}
+	if len(rule.Constraints) == 0 {
+		return nil, nil
+	}
+
+	// Constraints fail closed, a call which cannot be decoded is refused
+	stored, err := b.readStoredABI(ctx, s, rule.ABIName)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return []string{fmt.Sprintf("%s on %s cannot be checked, as no ABI is stored as %s", methodName, scope, rule.ABIName)}, nil
+	}
+	contractABI, err := ParseABI(stored.ABI)
+	if err != nil {
+		return nil, err
+	}
+	method, decodedArgs, err := DecodeCall(contractABI, calldata)
+	if err != nil {
+		return []string{fmt.Sprintf("%s on %s cannot be checked: %v", methodName, scope, err)}, nil
+	}
+	violations := []string{}
+	for _, constraint := range rule.Constraints {
+		index := argIndex(method, constraint.Arg)
+		if index < 0 {
+			return nil, errors.New(method.Sig() + " no longer has the argument " + constraint.Arg)
+		}
+		if violation := constraint.violation(method.Sig(), decodedArgs[index]["value"]); violation != "" {
+			violations = append(violations, violation+" on "+scope)
+		}
+	}
+	return violations, nil
+}
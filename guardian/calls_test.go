@@ -0,0 +1,68 @@
+package guardian
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/eximchain/go-ethereum/common"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestMethodSelector(t *testing.T) {
+	for _, method := range []string{"transfer(address,uint256)", "0xa9059cbb", "0XA9059CBB"} {
+		selector, _, err := methodSelector(method)
+		if err != nil {
+			t.Errorf("%s: %v", method, err)
+		} else if selector != "0xa9059cbb" {
+			t.Errorf("%s has selector %s", method, selector)
+		}
+	}
+	if _, signature, err := methodSelector("multicall(bytes[],uint8[2][])"); err != nil || signature != "multicall(bytes[],uint8[2][])" {
+		t.Errorf("array signature: %s %v", signature, err)
+	}
+	for _, method := range []string{
+		"approve(address,uint)",
+		"transfer(address, uint256)",
+		"transfer(address,uint256 amount)",
+		"transfer(address,uint7)",
+		"transfer(address,bytes33)",
+		"transfer(address,uint256[01])",
+		"swap((address,uint256))",
+		"0xa9059c",
+		"transfer",
+	} {
+		if _, _, err := methodSelector(method); err == nil {
+			t.Errorf("%s was accepted", method)
+		}
+	}
+}
+
+func TestCallViolationsRefusePrivateTxs(t *testing.T) {
+	ctx := context.Background()
+	b := Backend(&logical.BackendConfig{})
+	s, _ := testStorage(t, b)
+	covered := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	uncovered := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	if err := b.writeCallPolicy(ctx, s, covered.Hex(), &CallPolicy{Mode: denylistMode, Rules: map[string]*CallRule{}}); err != nil {
+		t.Fatal(err)
+	}
+	payloadHash := strings.Repeat("ab", 64)
+
+	violations, err := b.callViolations(ctx, s, []*txArgs{{To: &uncovered, Private: true, Data: payloadHash}})
+	if err != nil || len(violations) != 0 {
+		t.Errorf("refused a private transaction no policy covers: %v %v", violations, err)
+	}
+	violations, err = b.callViolations(ctx, s, []*txArgs{{To: &covered, Private: true, Data: payloadHash}})
+	if err != nil || len(violations) != 1 {
+		t.Errorf("allowed a private transaction to a covered contract: %v %v", violations, err)
+	}
+
+	if err := b.writeCallPolicy(ctx, s, anyContractScope, &CallPolicy{Mode: denylistMode, Rules: map[string]*CallRule{}}); err != nil {
+		t.Fatal(err)
+	}
+	violations, err = b.callViolations(ctx, s, []*txArgs{{To: &uncovered, Private: true, Data: payloadHash}})
+	if err != nil || len(violations) != 1 {
+		t.Errorf("allowed a private transaction under calls/any: %v %v", violations, err)
+	}
+}
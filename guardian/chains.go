@@ -0,0 +1,185 @@
+package guardian
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// ChainProfile : A chain registered by an admin under chains/<name>.  Transactions are only signed
+// for enabled chains, and are held to the chain's defaults and limits.
+type ChainProfile struct {
+	Name    string `json:"name"`
+	ChainID int    `json:"chain_id"`
+	Enabled bool   `json:"enabled"`
+	// RPCURL is the JSON-RPC node used to sync nonces and broadcast, if any
+	RPCURL string `json:"rpc_url,omitempty"`
+	// DefaultGasLimit is used when a transaction leaves out its gas_limit, 0 for no default
+	DefaultGasLimit uint64 `json:"default_gas_limit,omitempty"`
+	// MaxGasPrice caps the gas_price, or max_fee_per_gas of EIP-1559 transactions, in wei
+	MaxGasPrice *big.Int `json:"max_gas_price,omitempty"`
+}
+
+const chainStoragePrefix = "chains/"
+
+func (b *backend) readChainProfile(ctx context.Context, s logical.Storage, name string) (*ChainProfile, error) {
+	entry, err := s.Get(ctx, chainStoragePrefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var profile ChainProfile
+	if err := entry.DecodeJSON(&profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (b *backend) writeChainProfile(ctx context.Context, s logical.Storage, profile *ChainProfile) error {
+	entry, err := logical.StorageEntryJSON(chainStoragePrefix+profile.Name, profile)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// chainProfileByID : The profile registered for the chain ID, or nil if there is none
+func (b *backend) chainProfileByID(ctx context.Context, s logical.Storage, chainID int) (*ChainProfile, error) {
+	names, err := s.List(ctx, chainStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		profile, err := b.readChainProfile(ctx, s, name)
+		if err != nil {
+			return nil, err
+		}
+		if profile != nil && profile.ChainID == chainID {
+			return profile, nil
+		}
+	}
+	return nil, nil
+}
+
+// migrateLegacyRPCURLs : Moves node URLs stored under the old rpc/<chain_id> paths onto chain profiles,
+// the first time chains are read.  A chain already registered keeps its own rpc_url if it has one, and
+// a chain ID with no profile gets an enabled chain-<id> one, as those chains were signed for before.
+func (b *backend) migrateLegacyRPCURLs(ctx context.Context, s logical.Storage) error {
+	cfg, err := b.Config(ctx, s)
+	if err != nil {
+		return err
+	}
+	if len(cfg.LegacyRPCURLs) == 0 {
+		return nil
+	}
+	b.configLock.Lock()
+	defer b.configLock.Unlock()
+	// Read it again, another request may have migrated the URLs while we waited
+	cfg, err = b.Config(ctx, s)
+	if err != nil {
+		return err
+	}
+	for chainID, url := range cfg.LegacyRPCURLs {
+		profile, err := b.chainProfileByID(ctx, s, chainID)
+		if err != nil {
+			return err
+		}
+		if profile == nil {
+			name := fmt.Sprintf("chain-%d", chainID)
+			taken, err := b.readChainProfile(ctx, s, name)
+			if err != nil {
+				return err
+			}
+			if taken != nil {
+				return fmt.Errorf("unable to migrate the rpc/%d url, chains/%s is registered for chain ID %d", chainID, name, taken.ChainID)
+			}
+			profile = &ChainProfile{Name: name, ChainID: chainID, Enabled: true}
+		}
+		if profile.RPCURL == "" {
+			profile.RPCURL = url
+		}
+		if err := b.writeChainProfile(ctx, s, profile); err != nil {
+			return err
+		}
+		delete(cfg.LegacyRPCURLs, chainID)
+	}
+	cfg.LegacyRPCURLs = nil
+	return b.writeConfig(ctx, s, cfg)
+}
+
+// resolveChain : Finds the enabled chain a request is for, by `chain` name or `chain_id`.
+// When both are given they must agree, and when neither is the request is refused rather than defaulted.
+func (b *backend) resolveChain(ctx context.Context, s logical.Storage, name string, chainID int) (*ChainProfile, error) {
+	if err := b.migrateLegacyRPCURLs(ctx, s); err != nil {
+		return nil, err
+	}
+	var profile *ChainProfile
+	var err error
+	switch {
+	case name != "":
+		profile, err = b.readChainProfile(ctx, s, name)
+		if err != nil {
+			return nil, err
+		}
+		if profile == nil {
+			return nil, fmt.Errorf("Unknown chain %s, an admin must register it under chains/ first.", name)
+		}
+		if chainID != 0 && chainID != profile.ChainID {
+			return nil, fmt.Errorf("Chain %s has chain ID %d, not `chain_id` %d.", name, profile.ChainID, chainID)
+		}
+	case chainID > 0:
+		profile, err = b.chainProfileByID(ctx, s, chainID)
+		if err != nil {
+			return nil, err
+		}
+		if profile == nil {
+			return nil, fmt.Errorf("Unknown chain ID %d, an admin must register it under chains/ first.", chainID)
+		}
+	default:
+		return nil, errors.New("Please supply the `chain` name or `chain_id` to sign for.")
+	}
+	if !profile.Enabled {
+		return nil, fmt.Errorf("Chain %s is disabled.", profile.Name)
+	}
+	return profile, nil
+}
+
+// applyChain : Settles the chain the transaction is for, filling in its default gas limit and
+// checking it against the chain's gas price cap
+func (b *backend) applyChain(ctx context.Context, s logical.Storage, args *txArgs) error {
+	profile, err := b.resolveChain(ctx, s, args.ChainName, args.ChainID)
+	if err != nil {
+		return err
+	}
+	args.Chain = profile
+	args.ChainID = profile.ChainID
+	if args.GasLimit == 0 {
+		if profile.DefaultGasLimit == 0 {
+			return fmt.Errorf("Chain %s has no default gas limit, please supply a `gas_limit`.", profile.Name)
+		}
+		args.GasLimit = profile.DefaultGasLimit
+	}
+	if profile.MaxGasPrice != nil {
+		price, priceField := args.GasPrice, "gas_price"
+		if args.TxType == dynamicFeeTxType {
+			price, priceField = args.MaxFeePerGas, "max_fee_per_gas"
+		}
+		if price != nil && price.Cmp(profile.MaxGasPrice) > 0 {
+			return fmt.Errorf("`%s` of %s wei is above chain %s's limit of %s wei.", priceField, price, profile.Name, profile.MaxGasPrice)
+		}
+	}
+	return nil
+}
+
+// node : The chain's JSON-RPC node
+func (profile *ChainProfile) node() (*chainNode, error) {
+	if profile.RPCURL == "" {
+		return nil, fmt.Errorf("chain %s has no rpc_url, an admin must add one to chains/%s", profile.Name, profile.Name)
+	}
+	return newChainNode(profile.RPCURL)
+}
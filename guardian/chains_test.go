@@ -0,0 +1,61 @@
+package guardian
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestMigrateLegacyRPCURLs(t *testing.T) {
+	ctx := context.Background()
+	b := Backend(&logical.BackendConfig{})
+	s, cfg := testStorage(t, b)
+
+	// mainnet is registered without a node, rinkeby with its own, and chain 5 not at all
+	if err := b.writeChainProfile(ctx, s, &ChainProfile{Name: "mainnet", ChainID: 1, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.writeChainProfile(ctx, s, &ChainProfile{Name: "rinkeby", ChainID: 4, Enabled: true, RPCURL: "https://rinkeby.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg.LegacyRPCURLs = map[int]string{
+		1: "https://mainnet.legacy.example.com",
+		4: "https://rinkeby.legacy.example.com",
+		5: "https://goerli.legacy.example.com",
+	}
+	if err := b.writeConfig(ctx, s, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := b.resolveChain(ctx, s, "", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Name != "chain-5" || profile.RPCURL != "https://goerli.legacy.example.com" {
+		t.Errorf("chain 5 migrated to %+v", profile)
+	}
+	for name, want := range map[string]string{
+		"mainnet": "https://mainnet.legacy.example.com",
+		"rinkeby": "https://rinkeby.example.com",
+	} {
+		profile, err := b.readChainProfile(ctx, s, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if profile.RPCURL != want {
+			t.Errorf("%s has rpc_url %s, want %s", name, profile.RPCURL, want)
+		}
+	}
+
+	migrated, err := b.Config(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrated.LegacyRPCURLs) != 0 {
+		t.Errorf("rpc_urls left in the config: %v", migrated.LegacyRPCURLs)
+	}
+	if migrated.MasterKeyVersion != cfg.MasterKeyVersion || len(migrated.MasterKeys) != len(cfg.MasterKeys) {
+		t.Error("migration lost the master keys")
+	}
+}
@@ -58,6 +58,17 @@ type Config struct {
 	GuardianToken string `json:"guardian_token"`
 	OktaURL       string `json:"okta_url"`
 	OktaToken     string `json:"okta_token"`
+	// ExportEnabled allows the export path to hand out encrypted keys, it is off unless an admin turns it on.
+	ExportEnabled bool `json:"export_enabled"`
+	// RefuseRawSigning turns off signing raw hashes, which call policies cannot see into, for every user.
+	RefuseRawSigning bool `json:"refuse_raw_signing"`
+	// MasterKeys wrap the data key of every stored private key, by version.
+	// MasterKeyVersion is the one new keys are sealed under.
+	MasterKeys       map[int][]byte `json:"master_keys,omitempty"`
+	MasterKeyVersion int            `json:"master_key_version"`
+	// LegacyRPCURLs are the node URLs the old rpc/<chain_id> paths stored by chain ID.  They are
+	// only read so migrateLegacyRPCURLs can move them onto chain profiles.
+	LegacyRPCURLs map[int]string `json:"rpc_urls,omitempty"`
 }
 
 // Client : Call on a Config to get a configured Client.
@@ -92,25 +103,11 @@ func (gc *Client) isNewUser(username string) (exists bool, err error) {
 	return resp == nil, nil
 }
 
-func (gc *Client) createEnduser(username string) (publicAddressHex string, err error) {
+func (gc *Client) createEnduser(username string) (err error) {
 	createData := map[string]interface{}{
 		"groups": []string{"vault-guardian-endusers"}}
 	_, userErr := gc.vault.Logical().Write(fmt.Sprintf("/auth/okta/users/%s", username), createData)
-	if userErr != nil {
-		return "", userErr
-	}
-	privKeyHex, publicAddressHex, createKeyErr := CreateKey()
-	if createKeyErr != nil {
-		return "", createKeyErr
-	}
-	secretData := map[string]interface{}{
-		"privKeyHex":       privKeyHex,
-		"publicAddressHex": publicAddressHex}
-	_, keyErr := gc.vault.Logical().Write(fmt.Sprintf("/keys/%s", username), secretData)
-	if keyErr != nil {
-		return "", keyErr
-	}
-	return publicAddressHex, nil
+	return userErr
 }
 
 //-----------------------------------------
@@ -143,28 +140,41 @@ func (gc *Client) usernameFromTokenAccessor(accessor string) (username string, e
 	return meta["name"].(string), nil
 }
 
-func (gc *Client) readKeyHexByUsername(username string) (privKeyHex string, err error) {
-	resp, err := gc.vault.Logical().Read(fmt.Sprintf("/keys/%s", username))
+//-----------------------------------------
+//  Legacy Key Mount
+//-----------------------------------------
+
+// Keys used to live in a separate /keys KV mount, these calls
+// only exist so that migrate-keys can import them into storage.
+
+func (gc *Client) listKeySecrets() (usernames []string, err error) {
+	resp, err := gc.vault.Logical().List("/keys")
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if resp == nil || resp.Data["keys"] == nil {
+		return []string{}, nil
+	}
+	for _, key := range resp.Data["keys"].([]interface{}) {
+		usernames = append(usernames, key.(string))
 	}
-	return resp.Data["privKeyHex"].(string), nil
+	return usernames, nil
 }
 
-func (gc *Client) readKeyHexByEntityID(EntityID string) (privKeyHex string, err error) {
-	username, usernameErr := gc.usernameFromEntityID(EntityID)
-	if usernameErr != nil {
-		return "", usernameErr
+func (gc *Client) readKeySecretByUsername(username string) (keyData map[string]interface{}, err error) {
+	resp, err := gc.vault.Logical().Read(fmt.Sprintf("/keys/%s", username))
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("no key found for %s", username)
 	}
-	return gc.readKeyHexByUsername(username)
+	return resp.Data, nil
 }
 
-func (gc *Client) readKeyHexByTokenAccessor(accessor string) (privKeyHex string, err error) {
-	username, usernameErr := gc.usernameFromTokenAccessor(accessor)
-	if usernameErr != nil {
-		return "", usernameErr
-	}
-	return gc.readKeyHexByUsername(username)
+func (gc *Client) deleteKeySecret(username string) (err error) {
+	_, err = gc.vault.Logical().Delete(fmt.Sprintf("/keys/%s", username))
+	return err
 }
 
 //-----------------------------------------
@@ -218,3 +228,20 @@ func (gc *Client) oktaAccountExists(username string) (exists bool, err error) {
 	}
 	return user != nil, nil
 }
+
+func (gc *Client) oktaGroupNames(username string) (groups []string, err error) {
+	user, _, err := gc.okta.User.GetUser(username, nil)
+	if err != nil {
+		return nil, err
+	}
+	oktaGroups, _, err := gc.okta.User.ListUserGroups(user.Id, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range oktaGroups {
+		if group.Profile != nil {
+			groups = append(groups, group.Profile.Name)
+		}
+	}
+	return groups, nil
+}
@@ -0,0 +1,290 @@
+package guardian
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/eximchain/go-ethereum/accounts/abi"
+	"github.com/eximchain/go-ethereum/common"
+	"github.com/hashicorp/vault/logical"
+)
+
+// StoredABI : A contract ABI saved under abis/<name>, so callers can refer to it by name.
+type StoredABI struct {
+	ABI string `json:"abi"`
+}
+
+const abiStoragePrefix = "abis/"
+
+// ParseABI : Parses ABI JSON, rejecting argument types the vendored encoder would pack incorrectly.
+func ParseABI(abiJSON string) (*abi.ABI, error) {
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		return nil, err
+	}
+	for name, method := range parsed.Methods {
+		for _, input := range method.Inputs {
+			if err := checkABIType(input.Type); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	return &parsed, nil
+}
+
+// checkABIType : Arrays may only hold static, non-array elements
+func checkABIType(t abi.Type) error {
+	if t.T != abi.SliceTy && t.T != abi.ArrayTy {
+		return nil
+	}
+	switch t.Elem.T {
+	case abi.SliceTy, abi.ArrayTy, abi.StringTy, abi.BytesTy:
+		return fmt.Errorf("arrays of %s are not supported", t.Elem)
+	}
+	return nil
+}
+
+// EncodeCall : ABI-encodes a call to method with arguments given as a JSON array, returning the calldata
+func EncodeCall(contractABI *abi.ABI, methodName, argsJSON string) (calldata []byte, method abi.Method, err error) {
+	method, ok := contractABI.Methods[methodName]
+	if !ok {
+		return nil, abi.Method{}, fmt.Errorf("the ABI has no method %s", methodName)
+	}
+	var rawArgs []interface{}
+	if strings.TrimSpace(argsJSON) != "" {
+		decoder := json.NewDecoder(bytes.NewReader([]byte(argsJSON)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&rawArgs); err != nil {
+			return nil, abi.Method{}, fmt.Errorf("args must be a JSON array: %v", err)
+		}
+	}
+	if len(rawArgs) != len(method.Inputs) {
+		return nil, abi.Method{}, fmt.Errorf("%s takes %d arguments, got %d", method.Sig(), len(method.Inputs), len(rawArgs))
+	}
+
+	args := make([]interface{}, len(rawArgs))
+	for i, input := range method.Inputs {
+		value, err := abiValue(input.Type, rawArgs[i])
+		if err != nil {
+			return nil, abi.Method{}, fmt.Errorf("argument %d (%s %s): %v", i, input.Type, input.Name, err)
+		}
+		args[i] = value.Interface()
+	}
+	calldata, err = contractABI.Pack(methodName, args...)
+	if err != nil {
+		return nil, abi.Method{}, err
+	}
+	return calldata, method, nil
+}
+
+// DecodeCall : Finds the method calldata calls and decodes its arguments, the inverse of EncodeCall.
+// Each argument is returned with its name, type and a JSON friendly value.
+func DecodeCall(contractABI *abi.ABI, calldata []byte) (method *abi.Method, args []map[string]interface{}, err error) {
+	if len(calldata) < 4 {
+		return nil, nil, errors.New("calldata is too short to hold a method selector")
+	}
+	method, err = contractABI.MethodById(calldata[:4])
+	if err != nil {
+		return nil, nil, err
+	}
+	// The vendored decoder can panic on malformed input rather than erroring
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			method, args, err = nil, nil, fmt.Errorf("calldata does not decode as %s", method.Sig())
+		}
+	}()
+	values, err := method.Inputs.UnpackValues(calldata[4:])
+	if err != nil {
+		return nil, nil, err
+	}
+	args = make([]map[string]interface{}, len(method.Inputs))
+	for i, input := range method.Inputs {
+		args[i] = map[string]interface{}{
+			"name":  input.Name,
+			"type":  input.Type.String(),
+			"value": abiDisplayValue(input.Type, reflect.ValueOf(values[i])),
+		}
+	}
+	return method, args, nil
+}
+
+// abiDisplayValue : Formats a decoded value of type t the way EncodeCall accepts it, integers as decimal strings and bytes as 0x hex
+func abiDisplayValue(t abi.Type, value reflect.Value) interface{} {
+	switch t.T {
+	case abi.SliceTy, abi.ArrayTy:
+		items := make([]interface{}, value.Len())
+		for i := range items {
+			items[i] = abiDisplayValue(*t.Elem, value.Index(i))
+		}
+		return items
+	case abi.IntTy, abi.UintTy:
+		if number, ok := value.Interface().(*big.Int); ok {
+			return number.String()
+		}
+		if t.T == abi.IntTy {
+			return strconv.FormatInt(value.Int(), 10)
+		}
+		return strconv.FormatUint(value.Uint(), 10)
+	case abi.AddressTy:
+		return value.Interface().(common.Address).Hex()
+	case abi.BytesTy, abi.FixedBytesTy, abi.FunctionTy:
+		raw := make([]byte, value.Len())
+		reflect.Copy(reflect.ValueOf(raw), value)
+		return "0x" + hex.EncodeToString(raw)
+	}
+	return value.Interface()
+}
+
+// abiValue : Converts a decoded JSON value into the Go type the ABI encoder expects for t.
+// Integers may be JSON numbers, decimal strings or 0x prefixed hex, byte types are 0x prefixed hex.
+func abiValue(t abi.Type, raw interface{}) (reflect.Value, error) {
+	switch t.T {
+	case abi.SliceTy, abi.ArrayTy:
+		items, ok := raw.([]interface{})
+		if !ok {
+			return reflect.Value{}, errors.New("expected an array")
+		}
+		var value reflect.Value
+		if t.T == abi.ArrayTy {
+			if len(items) != t.Size {
+				return reflect.Value{}, fmt.Errorf("expected %d items, got %d", t.Size, len(items))
+			}
+			value = reflect.New(t.Type).Elem()
+		} else {
+			value = reflect.MakeSlice(t.Type, len(items), len(items))
+		}
+		for i, item := range items {
+			elem, err := abiValue(*t.Elem, item)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("item %d: %v", i, err)
+			}
+			value.Index(i).Set(elem)
+		}
+		return value, nil
+
+	case abi.IntTy, abi.UintTy:
+		number, err := parseJSONInteger(raw)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if t.T == abi.UintTy && (number.Sign() < 0 || number.BitLen() > t.Size) {
+			return reflect.Value{}, fmt.Errorf("%s is out of range for %s", number, t)
+		}
+		if t.T == abi.IntTy {
+			bound := new(big.Int).Lsh(big.NewInt(1), uint(t.Size-1))
+			if number.Cmp(bound) >= 0 || number.Cmp(new(big.Int).Neg(bound)) < 0 {
+				return reflect.Value{}, fmt.Errorf("%s is out of range for %s", number, t)
+			}
+		}
+		if t.Kind == reflect.Ptr {
+			return reflect.ValueOf(number), nil
+		}
+		value := reflect.New(t.Type).Elem()
+		if t.T == abi.UintTy {
+			value.SetUint(number.Uint64())
+		} else {
+			value.SetInt(number.Int64())
+		}
+		return value, nil
+
+	case abi.BoolTy:
+		flag, ok := raw.(bool)
+		if !ok {
+			return reflect.Value{}, errors.New("expected true or false")
+		}
+		return reflect.ValueOf(flag), nil
+
+	case abi.StringTy:
+		str, ok := raw.(string)
+		if !ok {
+			return reflect.Value{}, errors.New("expected a string")
+		}
+		return reflect.ValueOf(str), nil
+
+	case abi.AddressTy:
+		str, ok := raw.(string)
+		if !ok || !common.IsHexAddress(str) {
+			return reflect.Value{}, errors.New("expected a hex address")
+		}
+		return reflect.ValueOf(common.HexToAddress(str)), nil
+
+	case abi.BytesTy:
+		decoded, err := parseJSONHexBytes(raw)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(decoded), nil
+
+	case abi.FixedBytesTy, abi.FunctionTy:
+		decoded, err := parseJSONHexBytes(raw)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if len(decoded) != t.Size {
+			return reflect.Value{}, fmt.Errorf("expected %d bytes, got %d", t.Size, len(decoded))
+		}
+		value := reflect.New(t.Type).Elem()
+		reflect.Copy(value, reflect.ValueOf(decoded))
+		return value, nil
+	}
+	return reflect.Value{}, fmt.Errorf("unsupported type %s", t)
+}
+
+// findStoredABIForCall : Looks through the stored ABIs for one defining the method calldata calls
+func (b *backend) findStoredABIForCall(ctx context.Context, s logical.Storage, calldata []byte) (name string, contractABI *abi.ABI, err error) {
+	if len(calldata) < 4 {
+		return "", nil, nil
+	}
+	names, err := s.List(ctx, abiStoragePrefix)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, name := range names {
+		stored, err := b.readStoredABI(ctx, s, name)
+		if err != nil {
+			return "", nil, err
+		}
+		if stored == nil {
+			continue
+		}
+		parsed, err := ParseABI(stored.ABI)
+		if err != nil {
+			continue
+		}
+		if _, err := parsed.MethodById(calldata[:4]); err == nil {
+			return name, parsed, nil
+		}
+	}
+	return "", nil, nil
+}
+
+func (b *backend) readStoredABI(ctx context.Context, s logical.Storage, name string) (*StoredABI, error) {
+	entry, err := s.Get(ctx, abiStoragePrefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var stored StoredABI
+	if err := entry.DecodeJSON(&stored); err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+func (b *backend) writeStoredABI(ctx context.Context, s logical.Storage, name string, stored *StoredABI) error {
+	entry, err := logical.StorageEntryJSON(abiStoragePrefix+name, stored)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
@@ -1,8 +1,12 @@
 package guardian
 
 import (
+	"crypto/ecdsa"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"math/big"
+	"strings"
 
 	"github.com/eximchain/go-ethereum/common"
 	"github.com/eximchain/go-ethereum/core/types"
@@ -34,14 +38,23 @@ func SignWithHexKey(hash []byte, privKeyHex string) (sig []byte, err error) {
 	return sig, nil
 }
 
-// SignTxWithHexKey : Accepts arguments to NewTransaction (albeit in a different order), returns a signed RLP-encoded transaction string
-func SignTxWithHexKey(chainID int, privKeyHex, data string, to common.Address, nonce, gasLimit uint64, amount, gasPrice *big.Int) (jsonTx, rlpTx string, err error) {
-	signer := types.NewEIP155Signer(big.NewInt(int64(chainID)))
-	dataBytes, decodeErr := hex.DecodeString(data)
-	if decodeErr != nil {
-		return "", "", decodeErr
+// HashPersonalMessage : EIP-191 hash used by personal_sign, keccak256("\x19Ethereum Signed Message:\n" + len(message) + message)
+func HashPersonalMessage(message []byte) []byte {
+	prefix := fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(message))
+	return crypto.Keccak256([]byte(prefix), message)
+}
+
+// SignTxWithHexKey : Accepts arguments to NewTransaction (albeit in a different order), returns a signed RLP-encoded transaction string.
+// A nil `to` builds a contract creation instead.
+func SignTxWithHexKey(chainID int, privKeyHex, data string, to *common.Address, nonce, gasLimit uint64, amount, gasPrice *big.Int) (jsonTx, rlpTx string, err error) {
+	return signLegacyTxWithHexKey(types.NewEIP155Signer(big.NewInt(int64(chainID))), privKeyHex, data, to, nonce, gasLimit, amount, gasPrice)
+}
+
+func signLegacyTxWithHexKey(signer types.Signer, privKeyHex, data string, to *common.Address, nonce, gasLimit uint64, amount, gasPrice *big.Int) (jsonTx, rlpTx string, err error) {
+	tx, buildErr := newLegacyTx(data, to, nonce, gasLimit, amount, gasPrice)
+	if buildErr != nil {
+		return "", "", buildErr
 	}
-	tx := types.NewTransaction(nonce, to, amount, gasLimit, gasPrice, dataBytes)
 	privKey, loadErr := crypto.HexToECDSA(privKeyHex)
 	if loadErr != nil {
 		return "", "", loadErr
@@ -62,6 +75,55 @@ func SignTxWithHexKey(chainID int, privKeyHex, data string, to common.Address, n
 	return string(txJSON), "0x" + hex.EncodeToString(rawTxBytes), nil
 }
 
+// newLegacyTx : Builds the unsigned transaction, a nil `to` builds a contract creation
+func newLegacyTx(data string, to *common.Address, nonce, gasLimit uint64, amount, gasPrice *big.Int) (*types.Transaction, error) {
+	dataBytes, err := hex.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+	if to == nil {
+		return types.NewContractCreation(nonce, amount, gasLimit, gasPrice, dataBytes), nil
+	}
+	return types.NewTransaction(nonce, *to, amount, gasLimit, gasPrice, dataBytes), nil
+}
+
+// RecoverSigner : Recovers the public key behind a signature over hash.  The signature is r ‖ s ‖ v, where v may be
+// a 0/1 recovery id, 27/28 as ecrecover expects, or an EIP-155 value of chainID*2 + 35/36, in which case chainID is set.
+func RecoverSigner(hash, sig []byte) (pubKey *ecdsa.PublicKey, recoveryID byte, chainID *big.Int, err error) {
+	if len(hash) != 32 {
+		return nil, 0, nil, errors.New("hash must be 32 bytes")
+	}
+	if len(sig) < 65 || len(sig) > 96 {
+		return nil, 0, nil, errors.New("signature must be r and s followed by v")
+	}
+	v := new(big.Int).SetBytes(sig[64:])
+	switch {
+	case v.Cmp(big.NewInt(35)) >= 0:
+		recovery := new(big.Int).Sub(v, big.NewInt(35))
+		recoveryID = byte(recovery.Bit(0))
+		chainID = recovery.Rsh(recovery, 1)
+	case v.Cmp(big.NewInt(27)) == 0 || v.Cmp(big.NewInt(28)) == 0:
+		recoveryID = byte(v.Int64() - 27)
+	case v.Cmp(big.NewInt(1)) <= 0:
+		recoveryID = byte(v.Int64())
+	default:
+		return nil, 0, nil, fmt.Errorf("%s is not a valid v", v)
+	}
+
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:64])
+	if !crypto.ValidateSignatureValues(recoveryID, r, s, false) {
+		return nil, 0, nil, errors.New("signature r and s values are out of range")
+	}
+	recoverable := make([]byte, 65)
+	copy(recoverable, sig[:64])
+	recoverable[64] = recoveryID
+	pubKey, err = crypto.SigToPub(hash, recoverable)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return pubKey, recoveryID, chainID, nil
+}
+
 // AddressFromHexKey : Given a private key as a hex string, return its corresponding hex address
 func AddressFromHexKey(privKeyHex string) (pubAddressHex string, err error) {
 	privKey, err := crypto.HexToECDSA(privKeyHex)
@@ -71,3 +133,12 @@ func AddressFromHexKey(privKeyHex string) (pubAddressHex string, err error) {
 	pubAddressHex = crypto.PubkeyToAddress(privKey.PublicKey).Hex()
 	return
 }
+
+// NormalizeHexKey : Strips an optional 0x prefix and surrounding whitespace from a hex private key
+func NormalizeHexKey(privKeyHex string) string {
+	privKeyHex = strings.TrimSpace(privKeyHex)
+	if strings.HasPrefix(privKeyHex, "0x") || strings.HasPrefix(privKeyHex, "0X") {
+		privKeyHex = privKeyHex[2:]
+	}
+	return strings.ToLower(privKeyHex)
+}
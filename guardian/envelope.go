@@ -0,0 +1,265 @@
+package guardian
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"sort"
+
+	uuid "github.com/hashicorp/go-uuid"
+)
+
+// SealedSecret : A secret encrypted under its own random data key, with the data key wrapped by a master key from Config.
+type SealedSecret struct {
+	MasterKeyVersion int    `json:"master_key_version"`
+	WrappedKey       []byte `json:"wrapped_key"`
+	Ciphertext       []byte `json:"ciphertext"`
+}
+
+// AES-256 keys are used for both master keys and data keys
+const envelopeKeySize = 32
+
+// RotateMasterKey : Generates a new master key version, which seals every secret from now on.
+// Older versions are kept so the secrets they wrap stay readable until rewrapped.
+func (cfg *Config) RotateMasterKey() error {
+	masterKey, err := uuid.GenerateRandomBytes(envelopeKeySize)
+	if err != nil {
+		return err
+	}
+	if cfg.MasterKeys == nil {
+		cfg.MasterKeys = map[int][]byte{}
+	}
+	cfg.MasterKeyVersion++
+	cfg.MasterKeys[cfg.MasterKeyVersion] = masterKey
+	return nil
+}
+
+// MasterKeyVersions : Versions of the master key still held in the config, oldest first.
+func (cfg *Config) MasterKeyVersions() []int {
+	versions := make([]int, 0, len(cfg.MasterKeys))
+	for version := range cfg.MasterKeys {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+func (cfg *Config) masterKey(version int) ([]byte, error) {
+	if cfg.MasterKeyVersion == 0 {
+		return nil, errors.New("no master key is configured, an admin must write to master-key/rotate")
+	}
+	masterKey, ok := cfg.MasterKeys[version]
+	if !ok {
+		return nil, fmt.Errorf("master key version %d is no longer held", version)
+	}
+	return masterKey, nil
+}
+
+// sealSecret : Encrypts plaintext under a fresh data key, wrapped by the latest master key.
+func (cfg *Config) sealSecret(plaintext []byte) (*SealedSecret, error) {
+	masterKey, err := cfg.masterKey(cfg.MasterKeyVersion)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := uuid.GenerateRandomBytes(envelopeKeySize)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(dataKey)
+	ciphertext, err := aesGCMSeal(dataKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := aesGCMSeal(masterKey, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &SealedSecret{MasterKeyVersion: cfg.MasterKeyVersion, WrappedKey: wrappedKey, Ciphertext: ciphertext}, nil
+}
+
+// openSecret : Decrypts a sealed secret, callers should zero the plaintext once done with it.
+func (cfg *Config) openSecret(sealed *SealedSecret) ([]byte, error) {
+	dataKey, err := cfg.unwrapDataKey(sealed)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(dataKey)
+	return aesGCMOpen(dataKey, sealed.Ciphertext)
+}
+
+// rewrapSecret : Re-wraps the secret's data key under the latest master key, the ciphertext is unchanged.
+func (cfg *Config) rewrapSecret(sealed *SealedSecret) (changed bool, err error) {
+	if sealed.MasterKeyVersion == cfg.MasterKeyVersion {
+		return false, nil
+	}
+	dataKey, err := cfg.unwrapDataKey(sealed)
+	if err != nil {
+		return false, err
+	}
+	defer zeroBytes(dataKey)
+	masterKey, err := cfg.masterKey(cfg.MasterKeyVersion)
+	if err != nil {
+		return false, err
+	}
+	wrappedKey, err := aesGCMSeal(masterKey, dataKey)
+	if err != nil {
+		return false, err
+	}
+	sealed.MasterKeyVersion = cfg.MasterKeyVersion
+	sealed.WrappedKey = wrappedKey
+	return true, nil
+}
+
+func (cfg *Config) unwrapDataKey(sealed *SealedSecret) ([]byte, error) {
+	masterKey, err := cfg.masterKey(sealed.MasterKeyVersion)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := aesGCMOpen(masterKey, sealed.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unwrap data key: %v", err)
+	}
+	return dataKey, nil
+}
+
+// KeyMaterial : The secret half of a wallet or key, sealed for storage. The plaintext
+// fields are only set on entries stored before envelope encryption, until master-key/rewrap seals them.
+type KeyMaterial struct {
+	Mnemonic       string        `json:"mnemonic,omitempty"`
+	PrivKeyHex     string        `json:"priv_key_hex,omitempty"`
+	SealedMnemonic *SealedSecret `json:"sealed_mnemonic,omitempty"`
+	SealedPrivKey  *SealedSecret `json:"sealed_priv_key,omitempty"`
+	// AccountPublicKey is the extended public key of HD material, so its addresses can be found without decrypting it
+	AccountPublicKey string `json:"account_public_key,omitempty"`
+}
+
+// sealKeyMaterial : Seals a mnemonic for HD wallets, or a hex private key for single keys.
+func sealKeyMaterial(cfg *Config, mnemonic, privKeyHex string) (KeyMaterial, error) {
+	var material KeyMaterial
+	var err error
+	if mnemonic != "" {
+		if material.AccountPublicKey, err = DeriveAccountPublicKey(mnemonic); err != nil {
+			return material, err
+		}
+		material.SealedMnemonic, err = cfg.sealSecret([]byte(mnemonic))
+	} else {
+		material.SealedPrivKey, err = cfg.sealSecret([]byte(privKeyHex))
+	}
+	return material, err
+}
+
+// IsHD : Whether the material is a mnemonic many addresses derive from, rather than a single key.
+func (m *KeyMaterial) IsHD() bool {
+	return m.Mnemonic != "" || m.SealedMnemonic != nil
+}
+
+// withMnemonic : Calls fn with the mnemonic, which is decrypted only for the duration of the call.
+func (m *KeyMaterial) withMnemonic(cfg *Config, fn func(mnemonic string) error) error {
+	if m.SealedMnemonic == nil {
+		return fn(m.Mnemonic)
+	}
+	plaintext, err := cfg.openSecret(m.SealedMnemonic)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(plaintext)
+	return fn(string(plaintext))
+}
+
+// withKeyHex : Calls fn with the hex private key at the address index, which is decrypted only for the duration of the call.
+func (m *KeyMaterial) withKeyHex(cfg *Config, addressIndex int, fn func(privKeyHex string) error) error {
+	if m.IsHD() {
+		return m.withMnemonic(cfg, func(mnemonic string) error {
+			privKeyHex, _, err := DeriveKeyFromMnemonic(mnemonic, addressIndex)
+			if err != nil {
+				return err
+			}
+			return fn(privKeyHex)
+		})
+	}
+	if addressIndex != 0 {
+		return errors.New("this account predates HD wallets, only address_index 0 is available")
+	}
+	if m.SealedPrivKey == nil {
+		return fn(m.PrivKeyHex)
+	}
+	plaintext, err := cfg.openSecret(m.SealedPrivKey)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(plaintext)
+	return fn(string(plaintext))
+}
+
+// rewrap : Seals any plaintext left from before envelope encryption and re-wraps sealed secrets under the latest master key,
+// recording the account public key of HD material stored without one.
+func (m *KeyMaterial) rewrap(cfg *Config) (changed bool, err error) {
+	if m.Mnemonic != "" || m.PrivKeyHex != "" {
+		sealed, err := sealKeyMaterial(cfg, m.Mnemonic, m.PrivKeyHex)
+		if err != nil {
+			return false, err
+		}
+		*m = sealed
+		return true, nil
+	}
+	for _, sealed := range []*SealedSecret{m.SealedMnemonic, m.SealedPrivKey} {
+		if sealed == nil {
+			continue
+		}
+		rewrapped, err := cfg.rewrapSecret(sealed)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || rewrapped
+	}
+	if m.IsHD() && m.AccountPublicKey == "" {
+		err = m.withMnemonic(cfg, func(mnemonic string) error {
+			m.AccountPublicKey, err = DeriveAccountPublicKey(mnemonic)
+			return err
+		})
+		if err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// aesGCMSeal : AES-GCM encryption with a random nonce prepended to the ciphertext
+func aesGCMSeal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := uuid.GenerateRandomBytes(gcm.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func aesGCMOpen(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sealed value is too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
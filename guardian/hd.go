@@ -0,0 +1,232 @@
+package guardian
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/eximchain/go-ethereum/common/math"
+	"github.com/eximchain/go-ethereum/crypto"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// DerivationPathBase : BIP-44 path for Ethereum accounts, address_index is appended as the final element.
+const DerivationPathBase = "m/44'/60'/0'/0"
+
+// MaxAddressIndex : Largest address_index which can be derived without hardening.
+const MaxAddressIndex = 1<<31 - 1
+
+const hardenedKeyStart = uint32(1 << 31)
+
+// CreateMnemonic : Generates 256 bits of entropy and returns them as a 24-word BIP-39 mnemonic
+func CreateMnemonic() (mnemonic string, err error) {
+	entropy := make([]byte, 32)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", err
+	}
+	checksum := sha256.Sum256(entropy)
+	bits := new(big.Int).SetBytes(append(entropy, checksum[0]))
+	words := make([]string, 24)
+	mask := big.NewInt(2047)
+	for i := len(words) - 1; i >= 0; i-- {
+		words[i] = bip39English[new(big.Int).And(bits, mask).Int64()]
+		bits.Rsh(bits, 11)
+	}
+	return strings.Join(words, " "), nil
+}
+
+// ValidateMnemonic : Checks a mnemonic is 12 to 24 words from the BIP-39 English wordlist and that its checksum matches
+func ValidateMnemonic(mnemonic string) error {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return fmt.Errorf("mnemonic must have 12, 15, 18, 21 or 24 words, not %d", len(words))
+	}
+	bits := new(big.Int)
+	for _, word := range words {
+		index, ok := bip39Index[word]
+		if !ok {
+			return fmt.Errorf("%s is not on the BIP-39 English wordlist", word)
+		}
+		bits.Lsh(bits, 11).Or(bits, big.NewInt(int64(index)))
+	}
+	// Every 3 words hold 32 bits of entropy and 1 bit of checksum
+	checksumBits := uint(len(words) / 3)
+	checksum := new(big.Int).And(bits, big.NewInt(1<<checksumBits-1))
+	entropy := math.PaddedBigBytes(bits.Rsh(bits, checksumBits), len(words)/3*4)
+	hash := sha256.Sum256(entropy)
+	if int64(hash[0]>>(8-checksumBits)) != checksum.Int64() {
+		return errors.New("mnemonic checksum is invalid")
+	}
+	return nil
+}
+
+// DeriveKeyFromMnemonic : Given a BIP-39 mnemonic and an address index, returns the hex private key & address at m/44'/60'/0'/0/<index>
+func DeriveKeyFromMnemonic(mnemonic string, addressIndex int) (privKeyHex, pubAddress string, err error) {
+	if addressIndex < 0 || addressIndex > MaxAddressIndex {
+		return "", "", fmt.Errorf("address_index must be between 0 and %d", MaxAddressIndex)
+	}
+	accountKey, accountChainCode, err := hdAccountKey(mnemonic)
+	if err != nil {
+		return "", "", err
+	}
+	key, _, err := hdChildKey(accountKey, accountChainCode, uint32(addressIndex))
+	if err != nil {
+		return "", "", err
+	}
+	privKeyHex = hex.EncodeToString(key)
+	pubAddress, err = AddressFromHexKey(privKeyHex)
+	return
+}
+
+// DeriveAddressesFromMnemonic : Returns the addresses for the first `count` address indexes of a BIP-39 mnemonic
+func DeriveAddressesFromMnemonic(mnemonic string, count int) (pubAddresses []string, err error) {
+	if count < 0 || count > MaxAddressIndex {
+		return nil, fmt.Errorf("count must be between 0 and %d", MaxAddressIndex)
+	}
+	accountKey, accountChainCode, err := hdAccountKey(mnemonic)
+	if err != nil {
+		return nil, err
+	}
+	pubAddresses = make([]string, count)
+	for i := range pubAddresses {
+		key, _, deriveErr := hdChildKey(accountKey, accountChainCode, uint32(i))
+		if deriveErr != nil {
+			return nil, deriveErr
+		}
+		privKey, loadErr := crypto.ToECDSA(key)
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		pubAddresses[i] = crypto.PubkeyToAddress(privKey.PublicKey).Hex()
+	}
+	return pubAddresses, nil
+}
+
+// DeriveAccountPublicKey : The extended public key at DerivationPathBase as hex, its compressed public key followed by its chain code
+func DeriveAccountPublicKey(mnemonic string) (accountPublicKey string, err error) {
+	accountKey, accountChainCode, err := hdAccountKey(mnemonic)
+	if err != nil {
+		return "", err
+	}
+	privKey, err := crypto.ToECDSA(accountKey)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(append(crypto.CompressPubkey(&privKey.PublicKey), accountChainCode...)), nil
+}
+
+// DeriveAddressFromAccountPublicKey : The address at m/44'/60'/0'/0/<index> for an account public key from DeriveAccountPublicKey,
+// found without the mnemonic
+func DeriveAddressFromAccountPublicKey(accountPublicKey string, addressIndex int) (pubAddress string, err error) {
+	if addressIndex < 0 || addressIndex > MaxAddressIndex {
+		return "", fmt.Errorf("address_index must be between 0 and %d", MaxAddressIndex)
+	}
+	extended, err := hex.DecodeString(accountPublicKey)
+	if err != nil || len(extended) != 33+32 {
+		return "", errors.New("account public key must be a 33 byte compressed key followed by a 32 byte chain code")
+	}
+	childKey, _, err := hdChildPublicKey(extended[:33], extended[33:], uint32(addressIndex))
+	if err != nil {
+		return "", err
+	}
+	pubKey, err := crypto.DecompressPubkey(childKey)
+	if err != nil {
+		return "", err
+	}
+	return crypto.PubkeyToAddress(*pubKey).Hex(), nil
+}
+
+// hdAccountKey : Stretches a mnemonic into its seed and derives the key & chain code at DerivationPathBase
+func hdAccountKey(mnemonic string) (key, chainCode []byte, err error) {
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, nil, err
+	}
+	seed := pbkdf2.Key([]byte(mnemonic), []byte("mnemonic"), 2048, 64, sha512.New)
+	key, chainCode = hdMasterKey(seed)
+	for _, index := range []uint32{44 + hardenedKeyStart, 60 + hardenedKeyStart, hardenedKeyStart, 0} {
+		key, chainCode, err = hdChildKey(key, chainCode, index)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return key, chainCode, nil
+}
+
+// hdMasterKey : BIP-32 master key and chain code for a seed
+func hdMasterKey(seed []byte) (key, chainCode []byte) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	return sum[:32], sum[32:]
+}
+
+// hdChildKey : BIP-32 private parent key to private child key derivation
+func hdChildKey(key, chainCode []byte, index uint32) (childKey, childChainCode []byte, err error) {
+	var data []byte
+	if index >= hardenedKeyStart {
+		data = append([]byte{0x00}, key...)
+	} else {
+		privKey, loadErr := crypto.ToECDSA(key)
+		if loadErr != nil {
+			return nil, nil, loadErr
+		}
+		data = crypto.CompressPubkey(&privKey.PublicKey)
+	}
+	indexBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(indexBytes, index)
+	data = append(data, indexBytes...)
+
+	mac := hmac.New(sha512.New, chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	curveOrder := crypto.S256().Params().N
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(curveOrder) >= 0 {
+		return nil, nil, errors.New("derived key is invalid, try the next index")
+	}
+	child := tweak.Add(tweak, new(big.Int).SetBytes(key))
+	child.Mod(child, curveOrder)
+	if child.Sign() == 0 {
+		return nil, nil, errors.New("derived key is invalid, try the next index")
+	}
+	return math.PaddedBigBytes(child, 32), sum[32:], nil
+}
+
+// hdChildPublicKey : BIP-32 public parent key to public child key derivation, which only non-hardened indexes allow
+func hdChildPublicKey(pubKey, chainCode []byte, index uint32) (childPubKey, childChainCode []byte, err error) {
+	if index >= hardenedKeyStart {
+		return nil, nil, errors.New("hardened keys cannot be derived from a public key")
+	}
+	parent, err := crypto.DecompressPubkey(pubKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	indexBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(indexBytes, index)
+
+	mac := hmac.New(sha512.New, chainCode)
+	mac.Write(append(append([]byte{}, pubKey...), indexBytes...))
+	sum := mac.Sum(nil)
+
+	curve := crypto.S256()
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(curve.Params().N) >= 0 {
+		return nil, nil, errors.New("derived key is invalid, try the next index")
+	}
+	tweakX, tweakY := curve.ScalarBaseMult(sum[:32])
+	childX, childY := curve.Add(tweakX, tweakY, parent.X, parent.Y)
+	if childX.Sign() == 0 && childY.Sign() == 0 {
+		return nil, nil, errors.New("derived key is invalid, try the next index")
+	}
+	child := ecdsa.PublicKey{Curve: curve, X: childX, Y: childY}
+	return crypto.CompressPubkey(&child), sum[32:], nil
+}
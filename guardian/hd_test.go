@@ -0,0 +1,134 @@
+package guardian
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestDeriveKeyFromMnemonic(t *testing.T) {
+	cases := []struct {
+		index      int
+		privKeyHex string
+		address    string
+	}{
+		{0, "1ab42cc412b618bdea3a599e3c9bae199ebf030895b039e9db1e30dafb12b727", "0x9858EfFD232B4033E47d90003D41EC34EcaEda94"},
+		{1, "9a983cb3d832fbde5ab49d692b7a8bf5b5d232479c99333d0fc8e1d21f1b55b6", "0x6Fac4D18c912343BF86fa7049364Dd4E424Ab9C0"},
+	}
+	for _, c := range cases {
+		privKeyHex, address, err := DeriveKeyFromMnemonic(testMnemonic, c.index)
+		if err != nil {
+			t.Fatalf("index %d: %v", c.index, err)
+		}
+		if privKeyHex != c.privKeyHex || address != c.address {
+			t.Errorf("index %d: got %s %s, want %s %s", c.index, privKeyHex, address, c.privKeyHex, c.address)
+		}
+	}
+
+	addresses, err := DeriveAddressesFromMnemonic(testMnemonic, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addresses[0] != cases[0].address || addresses[1] != cases[1].address {
+		t.Errorf("DeriveAddressesFromMnemonic got %v", addresses)
+	}
+}
+
+// BIP-32 test vector 1, chain m/0H/1/2H/2/1000000000
+func TestHDChildKeyVector1(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	steps := []struct {
+		index     uint32
+		key       string
+		chainCode string
+	}{
+		{hardenedKeyStart, "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea", "47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141"},
+		{1, "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368", "2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19"},
+		{2 + hardenedKeyStart, "cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca", "04466b9cc8e161e966409ca52986c584f07e9dc81f735db683c3ff6ec7b1503f"},
+		{2, "0f479245fb19a38a1954c5c7c0ebab2f9bdfd96a17563ef28a6a4b1a2a764ef4", "cfb71883f01676f587d023cc53a35bc7f88f724b1f8c2892ac1275ac822a3edd"},
+		{1000000000, "471b76e389e528d6de6d816857e012c5455051cad6660850e58372a6c3e6e7c8", "c783e67b921d2beb8f6b389cc646d7263b4145701dadd2161548a8b078e65e9e"},
+	}
+
+	key, chainCode := hdMasterKey(seed)
+	if hex.EncodeToString(key) != "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35" ||
+		hex.EncodeToString(chainCode) != "873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508" {
+		t.Fatalf("master key got %x %x", key, chainCode)
+	}
+	for _, step := range steps {
+		var err error
+		key, chainCode, err = hdChildKey(key, chainCode, step.index)
+		if err != nil {
+			t.Fatalf("index %d: %v", step.index, err)
+		}
+		if hex.EncodeToString(key) != step.key || hex.EncodeToString(chainCode) != step.chainCode {
+			t.Fatalf("index %d: got %x %x, want %s %s", step.index, key, chainCode, step.key, step.chainCode)
+		}
+	}
+}
+
+func TestValidateMnemonic(t *testing.T) {
+	valid := []string{
+		testMnemonic,
+		"legal winner thank year wave sausage worth useful legal winner thank yellow",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+	}
+	for _, mnemonic := range valid {
+		if err := ValidateMnemonic(mnemonic); err != nil {
+			t.Errorf("%q: %v", mnemonic, err)
+		}
+	}
+
+	invalid := []string{
+		strings.Repeat("abandon ", 12),
+		"legal winner thank year wave sausage worth useful legal winner thank year",
+		strings.Repeat("zoo ", 24),
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon aboutt",
+	}
+	for _, mnemonic := range invalid {
+		if err := ValidateMnemonic(mnemonic); err == nil {
+			t.Errorf("%q was accepted", mnemonic)
+		}
+		if _, _, err := DeriveKeyFromMnemonic(mnemonic, 0); err == nil {
+			t.Errorf("%q was derived from", mnemonic)
+		}
+	}
+}
+
+func TestCreateMnemonic(t *testing.T) {
+	mnemonic, err := CreateMnemonic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if words := strings.Fields(mnemonic); len(words) != 24 {
+		t.Fatalf("got %d words", len(words))
+	}
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeriveAddressFromAccountPublicKey(t *testing.T) {
+	accountPublicKey, err := DeriveAccountPublicKey(testMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addressIndex := 0; addressIndex < 5; addressIndex++ {
+		_, want, err := DeriveKeyFromMnemonic(testMnemonic, addressIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := DeriveAddressFromAccountPublicKey(accountPublicKey, addressIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("index %d: %s from the public key, %s from the mnemonic", addressIndex, got, want)
+		}
+	}
+	if _, err := DeriveAddressFromAccountPublicKey(accountPublicKey[:64], 1); err == nil {
+		t.Error("derived from a truncated public key")
+	}
+}
@@ -0,0 +1,374 @@
+package guardian
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eximchain/go-ethereum/common"
+	"github.com/hashicorp/vault/helper/locksutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// NamedKey : A standalone key a user created under their own name, e.g. "payroll" or "testnet".
+type NamedKey struct {
+	KeyMaterial
+	PublicAddressHex string     `json:"public_address_hex"`
+	CreatedAt        time.Time  `json:"created_at"`
+	ArchivedAt       *time.Time `json:"archived_at,omitempty"`
+	// ArchivedVersions holds the keys this one replaced on rotation, oldest first.
+	ArchivedVersions []ArchivedKey `json:"archived_versions,omitempty"`
+}
+
+// NewNamedKey : Seals the hex private key into a NamedKey, callers check it holds pubAddress.
+func NewNamedKey(cfg *Config, privKeyHex, pubAddress string) (*NamedKey, error) {
+	material, err := sealKeyMaterial(cfg, "", privKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	return &NamedKey{KeyMaterial: material, PublicAddressHex: pubAddress, CreatedAt: time.Now().UTC()}, nil
+}
+
+// Archived : Archived keys are kept for reference but can no longer sign.
+func (k *NamedKey) Archived() bool {
+	return k.ArchivedAt != nil
+}
+
+// Version : Versions count up from 1, the current key is always the latest.
+func (k *NamedKey) Version() int {
+	return len(k.ArchivedVersions) + 1
+}
+
+// Rotate : Archives the current key and replaces it with a freshly generated one.
+func (k *NamedKey) Rotate(cfg *Config) error {
+	privKeyHex, pubAddress, err := CreateKey()
+	if err != nil {
+		return err
+	}
+	fresh, err := NewNamedKey(cfg, privKeyHex, pubAddress)
+	if err != nil {
+		return err
+	}
+	k.ArchivedVersions = append(k.ArchivedVersions, ArchivedKey{
+		Version:          k.Version(),
+		KeyMaterial:      k.KeyMaterial,
+		PublicAddressHex: k.PublicAddressHex,
+		CreatedAt:        k.CreatedAt,
+		RetiredAt:        fresh.CreatedAt,
+	})
+	k.KeyMaterial = fresh.KeyMaterial
+	k.PublicAddressHex = fresh.PublicAddressHex
+	k.CreatedAt = fresh.CreatedAt
+	return nil
+}
+
+// VersionKeyMaterial : Returns the sealed key material of the given version.
+func (k *NamedKey) VersionKeyMaterial(version int) (KeyMaterial, error) {
+	if version == k.Version() {
+		return k.KeyMaterial, nil
+	}
+	if version < 1 || version > k.Version() {
+		return KeyMaterial{}, fmt.Errorf("version must be between 1 and %d", k.Version())
+	}
+	return k.ArchivedVersions[version-1].KeyMaterial, nil
+}
+
+// VersionAddress : The address of the given version of the key, callers check the version exists.
+func (k *NamedKey) VersionAddress(version int) string {
+	if version == k.Version() {
+		return k.PublicAddressHex
+	}
+	return k.ArchivedVersions[version-1].PublicAddressHex
+}
+
+// rewrap : Rewraps the current and archived key material under the latest master key.
+func (k *NamedKey) rewrap(cfg *Config) (changed bool, err error) {
+	changed, err = k.KeyMaterial.rewrap(cfg)
+	if err != nil {
+		return false, err
+	}
+	for i := range k.ArchivedVersions {
+		archivedChanged, err := k.ArchivedVersions[i].KeyMaterial.rewrap(cfg)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || archivedChanged
+	}
+	return changed, nil
+}
+
+const namedKeysStoragePrefix = "named-keys/"
+
+func namedKeyStoragePrefix(username string) string {
+	return namedKeysStoragePrefix + username + "/"
+}
+
+// lockKeyPaths : Locks the storage paths a new key will be written to, so checking they are free and
+// writing the key happen as one.  Call the returned func to unlock them.
+func (b *backend) lockKeyPaths(paths ...string) (unlock func()) {
+	locks := locksutil.LocksForKeys(b.keyLocks, paths)
+	for _, lock := range locks {
+		lock.Lock()
+	}
+	return func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+		}
+	}
+}
+
+func (b *backend) readNamedKey(ctx context.Context, s logical.Storage, username, name string) (*NamedKey, error) {
+	entry, err := s.Get(ctx, namedKeyStoragePrefix(username)+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var key NamedKey
+	if err := entry.DecodeJSON(&key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (b *backend) writeNamedKey(ctx context.Context, s logical.Storage, username, name string, key *NamedKey) error {
+	entry, err := logical.StorageEntryJSON(namedKeyStoragePrefix(username)+name, key)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+func (b *backend) listNamedKeys(ctx context.Context, s logical.Storage, username string) ([]string, error) {
+	return s.List(ctx, namedKeyStoragePrefix(username))
+}
+
+// listKeyHolders : Every username holding a wallet, named keys or both
+func (b *backend) listKeyHolders(ctx context.Context, s logical.Storage) ([]string, error) {
+	usernames, err := b.listWallets(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	// Named keys are listed as "<username>/" under their prefix
+	userPrefixes, err := s.List(ctx, namedKeysStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, username := range usernames {
+		seen[username] = true
+	}
+	for _, userPrefix := range userPrefixes {
+		username := strings.TrimSuffix(userPrefix, "/")
+		if !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+	}
+	sort.Strings(usernames)
+	return usernames, nil
+}
+
+// addressOwner : Records which user holds an address, so the same key cannot be held twice.
+type addressOwner struct {
+	Username string `json:"username"`
+	// KeyName is empty when the address belongs to the user's HD wallet.
+	KeyName string `json:"key_name,omitempty"`
+}
+
+func addressOwnerStoragePath(pubAddress string) string {
+	return "addresses/" + strings.ToLower(common.HexToAddress(pubAddress).Hex())
+}
+
+func (b *backend) readAddressOwner(ctx context.Context, s logical.Storage, pubAddress string) (*addressOwner, error) {
+	entry, err := s.Get(ctx, addressOwnerStoragePath(pubAddress))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var owner addressOwner
+	if err := entry.DecodeJSON(&owner); err != nil {
+		return nil, err
+	}
+	return &owner, nil
+}
+
+func (b *backend) writeAddressOwner(ctx context.Context, s logical.Storage, pubAddress string, owner *addressOwner) error {
+	entry, err := logical.StorageEntryJSON(addressOwnerStoragePath(pubAddress), owner)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// hdOwnedAddressCount : How many addresses of each HD wallet are recorded as held by its user, BIP-44's gap limit.
+// Importing an address derived past it is not refused.
+const hdOwnedAddressCount = 20
+
+// writeWalletOwner : Records the user as holding every version of their wallet, including the first
+// hdOwnedAddressCount addresses of each HD version
+func (b *backend) writeWalletOwner(ctx context.Context, s logical.Storage, cfg *Config, username string, wallet *Wallet) error {
+	owner := &addressOwner{Username: username}
+	for version := 1; version <= wallet.Version(); version++ {
+		atVersion, err := wallet.AtVersion(version)
+		if err != nil {
+			return err
+		}
+		pubAddresses, err := atVersion.Addresses(cfg, hdOwnedAddressCount)
+		if err != nil {
+			return err
+		}
+		for _, pubAddress := range pubAddresses {
+			if err := b.writeAddressOwner(ctx, s, pubAddress, owner); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SigningKey : The key a request signs with, which stays sealed until the moment it signs.
+type SigningKey struct {
+	material     KeyMaterial
+	addressIndex int
+	cfg          *Config
+	// pubAddress is the address known without decrypting the key, empty for HD addresses past index 0
+	// of wallets stored without an account public key
+	pubAddress string
+}
+
+// Sign : Signs the hash, the private key is decrypted only for the duration of the signature.
+func (k *SigningKey) Sign(hash []byte) (sig []byte, err error) {
+	err = k.material.withKeyHex(k.cfg, k.addressIndex, func(privKeyHex string) error {
+		sig, err = SignWithHexKey(hash, privKeyHex)
+		return err
+	})
+	return sig, err
+}
+
+// SignMessage : Signs the message with the EIP-191 personal_sign prefix, v is 27 or 28 as ecrecover expects.
+func (k *SigningKey) SignMessage(message []byte) (sig []byte, err error) {
+	return k.signForEcrecover(HashPersonalMessage(message))
+}
+
+// SignTypedData : Signs the EIP-712 digest of the typed data, v is 27 or 28 as ecrecover expects.
+func (k *SigningKey) SignTypedData(typedData *TypedData) (sig, domainSeparator, structHash []byte, err error) {
+	hash, domainSeparator, structHash, err := typedData.HashTypedData()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	sig, err = k.signForEcrecover(hash)
+	return sig, domainSeparator, structHash, err
+}
+
+func (k *SigningKey) signForEcrecover(hash []byte) (sig []byte, err error) {
+	sig, err = k.Sign(hash)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
+
+// SignTx : Builds and signs the transaction, the private key is decrypted only for the duration of the signature.
+func (k *SigningKey) SignTx(args *txArgs) (jsonTx, rlpTx string, err error) {
+	err = k.material.withKeyHex(k.cfg, k.addressIndex, func(privKeyHex string) error {
+		jsonTx, rlpTx, err = args.signWithHexKey(privKeyHex)
+		return err
+	})
+	return jsonTx, rlpTx, err
+}
+
+// Address : The public address of the key.
+func (k *SigningKey) Address() (pubAddress string, err error) {
+	if k.pubAddress != "" {
+		return k.pubAddress, nil
+	}
+	err = k.material.withKeyHex(k.cfg, k.addressIndex, func(privKeyHex string) error {
+		pubAddress, err = AddressFromHexKey(privKeyHex)
+		return err
+	})
+	return pubAddress, err
+}
+
+// StoredAddress : The address of the key found from storage without decrypting it.  Empty for HD addresses
+// past index 0 of wallets stored without an account public key, which can only be derived from the mnemonic.
+func (k *SigningKey) StoredAddress() string {
+	return k.pubAddress
+}
+
+// signingKey : Resolves which key a sign request uses for its user,
+// either the named key in `key_name` or the HD address at `address_index`.
+// Paths which accept `key_version` may reach back to archived versions.
+func (b *backend) signingKey(ctx context.Context, s logical.Storage, username string, data *framework.FieldData) (*SigningKey, error) {
+	keyName, hasKeyName := data.GetOk("key_name")
+	_, hasAddressIndex := data.GetOk("address_index")
+	if hasKeyName && hasAddressIndex {
+		return nil, errors.New("provide either key_name or address_index, not both")
+	}
+	keyVersion, hasKeyVersion := data.GetOk("key_version")
+	cfg, err := b.Config(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasKeyName {
+		key, readErr := b.readNamedKey(ctx, s, username, keyName.(string))
+		if readErr != nil {
+			return nil, readErr
+		}
+		if key == nil {
+			return nil, fmt.Errorf("no key named %s", keyName.(string))
+		}
+		if hasKeyVersion {
+			material, versionErr := key.VersionKeyMaterial(keyVersion.(int))
+			if versionErr != nil {
+				return nil, versionErr
+			}
+			return &SigningKey{material: material, cfg: cfg, pubAddress: key.VersionAddress(keyVersion.(int))}, nil
+		}
+		if key.Archived() {
+			return nil, fmt.Errorf("key %s is archived and can no longer sign", keyName.(string))
+		}
+		return &SigningKey{material: key.KeyMaterial, cfg: cfg, pubAddress: key.PublicAddressHex}, nil
+	}
+
+	addressIndex, indexErr := addressIndexFromData(data)
+	if indexErr != nil {
+		return nil, indexErr
+	}
+	wallet, readErr := b.readWalletByUsername(ctx, s, username)
+	if readErr != nil {
+		return nil, readErr
+	}
+	if hasKeyVersion {
+		wallet, readErr = wallet.AtVersion(keyVersion.(int))
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+	signingKey := &SigningKey{material: wallet.KeyMaterial, addressIndex: addressIndex, cfg: cfg}
+	if addressIndex == 0 {
+		signingKey.pubAddress = wallet.PublicAddressHex
+	} else if wallet.AccountPublicKey != "" {
+		if signingKey.pubAddress, err = DeriveAddressFromAccountPublicKey(wallet.AccountPublicKey, addressIndex); err != nil {
+			return nil, err
+		}
+	}
+	return signingKey, nil
+}
+
+func addressIndexFromData(data *framework.FieldData) (int, error) {
+	addressIndex := data.Get("address_index").(int)
+	if addressIndex < 0 || addressIndex > MaxAddressIndex {
+		return 0, fmt.Errorf("address_index must be between 0 and %d", MaxAddressIndex)
+	}
+	return addressIndex, nil
+}
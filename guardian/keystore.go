@@ -0,0 +1,89 @@
+package guardian
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/eximchain/go-ethereum/accounts/keystore"
+	"github.com/eximchain/go-ethereum/common"
+	"github.com/eximchain/go-ethereum/crypto"
+	"github.com/pborman/uuid"
+)
+
+// EncryptKeystoreV3 : Encrypts a hex private key under a passphrase, returning keystore v3 JSON as geth's accounts/keystore writes it
+func EncryptKeystoreV3(privKeyHex, passphrase string, scryptN, scryptP int) (keyJSON []byte, err error) {
+	privKey, err := crypto.HexToECDSA(privKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	return keystore.EncryptKey(&keystore.Key{
+		Id:         uuid.NewRandom(),
+		Address:    crypto.PubkeyToAddress(privKey.PublicKey),
+		PrivateKey: privKey,
+	}, passphrase, scryptN, scryptP)
+}
+
+// DecryptKeystoreV3 : Given keystore JSON and its passphrase, returns the hex private key inside.
+// Decryption is left to accounts/keystore once the file's KDF parameters are checked.
+func DecryptKeystoreV3(keyJSON []byte, passphrase string) (privKeyHex string, err error) {
+	var header keystoreHeader
+	if err := json.Unmarshal(keyJSON, &header); err != nil {
+		return "", err
+	}
+	if err := header.checkKDFParams(); err != nil {
+		return "", err
+	}
+	key, err := keystore.DecryptKey(keyJSON, passphrase)
+	if err != nil {
+		return "", err
+	}
+	if header.Address != "" && common.HexToAddress(header.Address) != key.Address {
+		return "", fmt.Errorf("keystore address %s does not match its key's address %s", header.Address, key.Address.Hex())
+	}
+	return hex.EncodeToString(crypto.FromECDSA(key.PrivateKey)), nil
+}
+
+// keystoreHeader : The parts of a keystore file checked before it is decrypted
+type keystoreHeader struct {
+	Address string `json:"address"`
+	Crypto  struct {
+		KDF       string                 `json:"kdf"`
+		KDFParams map[string]interface{} `json:"kdfparams"`
+	} `json:"crypto"`
+}
+
+// Upper bounds on the work an imported keystore file may ask for, geth's standard parameters are the most expensive allowed.
+const (
+	maxKeystoreScryptN          = 1 << 18
+	maxKeystorePBKDF2Iterations = 10000000
+	maxKeystoreDKLen            = 64
+)
+
+// checkKDFParams : Refuses parameters which would let a crafted file exhaust the plugin's memory or CPU
+func (header *keystoreHeader) checkKDFParams() error {
+	params := header.Crypto.KDFParams
+	if dkLen := keystoreIntParam(params, "dklen"); dkLen < 32 || dkLen > maxKeystoreDKLen {
+		return fmt.Errorf("keystore dklen must be between 32 and %d", maxKeystoreDKLen)
+	}
+	switch header.Crypto.KDF {
+	case "scrypt":
+		n, r, p := keystoreIntParam(params, "n"), keystoreIntParam(params, "r"), keystoreIntParam(params, "p")
+		if n > maxKeystoreScryptN || r > 8 || p > 16 {
+			return fmt.Errorf("keystore scrypt parameters exceed n=%d, r=8, p=16", maxKeystoreScryptN)
+		}
+	case "pbkdf2":
+		if c := keystoreIntParam(params, "c"); c <= 0 || c > maxKeystorePBKDF2Iterations {
+			return fmt.Errorf("keystore c must be between 1 and %d", maxKeystorePBKDF2Iterations)
+		}
+	default:
+		return fmt.Errorf("keystore kdf %s is not supported, only scrypt and pbkdf2", header.Crypto.KDF)
+	}
+	return nil
+}
+
+// keystoreIntParam : JSON numbers decode as float64, anything missing or malformed becomes 0
+func keystoreIntParam(params map[string]interface{}, name string) int {
+	value, _ := params[name].(float64)
+	return int(value)
+}
@@ -0,0 +1,110 @@
+package guardian
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eximchain/go-ethereum/accounts/keystore"
+)
+
+// gethKeystoreTestdata : geth's own keystore fixtures, vendored with accounts/keystore
+var gethKeystoreTestdata = filepath.Join("..", "vendor", "github.com", "eximchain", "go-ethereum", "accounts", "keystore", "testdata")
+
+type keystoreTestVector struct {
+	JSON     json.RawMessage `json:"json"`
+	Password string          `json:"password"`
+	Priv     string          `json:"priv"`
+}
+
+func readKeystoreTestVectors(t *testing.T, file string) map[string]keystoreTestVector {
+	raw, err := ioutil.ReadFile(filepath.Join(gethKeystoreTestdata, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectors := map[string]keystoreTestVector{}
+	if err := json.Unmarshal(raw, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	return vectors
+}
+
+func TestDecryptKeystoreV3Vectors(t *testing.T) {
+	for _, file := range []string{"v3_test_vector.json", "v1_test_vector.json"} {
+		for name, vector := range readKeystoreTestVectors(t, file) {
+			privKeyHex, err := DecryptKeystoreV3(vector.JSON, vector.Password)
+			if err != nil {
+				t.Errorf("%s %s: %v", file, name, err)
+				continue
+			}
+			// Keys shorter than 32 bytes come back left padded
+			if want := fmt.Sprintf("%064s", vector.Priv); privKeyHex != strings.Replace(want, " ", "0", -1) {
+				t.Errorf("%s %s: got %s, want %s", file, name, privKeyHex, vector.Priv)
+			}
+			if _, err := DecryptKeystoreV3(vector.JSON, vector.Password+"wrong"); err == nil {
+				t.Errorf("%s %s: decrypted with the wrong passphrase", file, name)
+			}
+		}
+	}
+}
+
+func TestDecryptKeystoreV3Refuses(t *testing.T) {
+	keyJSON, err := ioutil.ReadFile(filepath.Join(gethKeystoreTestdata, "very-light-scrypt.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptKeystoreV3(keyJSON, ""); err != nil {
+		t.Fatalf("very-light-scrypt.json: %v", err)
+	}
+
+	cases := map[string][2]string{
+		"address mismatch": {`"address":"45dea0fb0bba44f4fcf290bba71fd57d7117cbb8"`, `"address":"0000000000000000000000000000000000000001"`},
+		"scrypt n":         {`"n":2`, `"n":1048576`},
+		"dklen":            {`"dklen":32`, `"dklen":16`},
+		"kdf":              {`"kdf":"scrypt"`, `"kdf":"argon2"`},
+	}
+	for name, replace := range cases {
+		tampered := strings.Replace(string(keyJSON), replace[0], replace[1], 1)
+		if tampered == string(keyJSON) {
+			t.Fatalf("%s: fixture does not contain %s", name, replace[0])
+		}
+		if _, err := DecryptKeystoreV3([]byte(tampered), ""); err == nil {
+			t.Errorf("%s: was decrypted", name)
+		}
+	}
+}
+
+func TestEncryptKeystoreV3RoundTrip(t *testing.T) {
+	keyJSON, err := ioutil.ReadFile(filepath.Join(gethKeystoreTestdata, "very-light-scrypt.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKeyHex, err := DecryptKeystoreV3(keyJSON, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reencrypted, err := EncryptKeystoreV3(privKeyHex, "round trip", keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header keystoreHeader
+	if err := json.Unmarshal(reencrypted, &header); err != nil {
+		t.Fatal(err)
+	}
+	if header.Address != "45dea0fb0bba44f4fcf290bba71fd57d7117cbb8" {
+		t.Errorf("exported address %s, want 45dea0fb0bba44f4fcf290bba71fd57d7117cbb8", header.Address)
+	}
+	decrypted, err := DecryptKeystoreV3(reencrypted, "round trip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted != privKeyHex {
+		t.Errorf("round trip gave %s, want %s", decrypted, privKeyHex)
+	}
+	if _, err := DecryptKeystoreV3(reencrypted, "wrong"); err == nil {
+		t.Error("decrypted with the wrong passphrase")
+	}
+}
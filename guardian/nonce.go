@@ -0,0 +1,253 @@
+package guardian
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/locksutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+// nonceState : The nonces Guardian has handed out for one address on one chain.
+// Next is the lowest never handed out, Released holds lower ones handed back unused, which are reused first.
+type nonceState struct {
+	Next     uint64     `json:"next"`
+	Released []uint64   `json:"released,omitempty"`
+	SyncedAt *time.Time `json:"synced_at,omitempty"`
+}
+
+const nonceStoragePrefix = "nonces/"
+
+func nonceStoragePath(chainID int, pubAddress string) string {
+	return fmt.Sprintf("%s%d/%s", nonceStoragePrefix, chainID, strings.ToLower(pubAddress))
+}
+
+// take : Hands out the lowest released nonce, or else the next one
+func (st *nonceState) take() uint64 {
+	if len(st.Released) > 0 {
+		nonce := st.Released[0]
+		st.Released = st.Released[1:]
+		return nonce
+	}
+	st.Next++
+	return st.Next - 1
+}
+
+// peek : The nonce take would hand out, without handing it out
+func (st *nonceState) peek() uint64 {
+	if len(st.Released) > 0 {
+		return st.Released[0]
+	}
+	return st.Next
+}
+
+// nonceUse : What use changed to record a nonce, so unuse can hand it back
+type nonceUse struct {
+	nonce        uint64
+	fromReleased bool
+	// previousNext is what Next was before use raised it past the nonce
+	previousNext uint64
+}
+
+// use : Records a nonce the caller chose for themselves, so it is not handed out again.
+// Nonces skipped over are not handed out either, as they may have been used elsewhere.
+// Returns nil if the nonce had already been handed out, as nothing changed.
+func (st *nonceState) use(nonce uint64) *nonceUse {
+	for i, released := range st.Released {
+		if released == nonce {
+			st.Released = append(st.Released[:i], st.Released[i+1:]...)
+			return &nonceUse{nonce: nonce, fromReleased: true}
+		}
+	}
+	if nonce < st.Next {
+		return nil
+	}
+	used := &nonceUse{nonce: nonce, previousNext: st.Next}
+	st.Next = nonce + 1
+	return used
+}
+
+// unuse : Undoes use for a nonce whose transaction was not signed.  If nothing has been handed out
+// since, the nonces it skipped over are restored too, otherwise only the nonce itself is released.
+func (st *nonceState) unuse(used *nonceUse) error {
+	if used.nonce >= st.Next {
+		// A sync has forgotten it already
+		return nil
+	}
+	if !used.fromReleased && st.Next == used.nonce+1 {
+		st.Next = used.previousNext
+		kept := []uint64{}
+		for _, released := range st.Released {
+			if released < st.Next {
+				kept = append(kept, released)
+			}
+		}
+		st.Released = kept
+		return nil
+	}
+	return st.release(used.nonce)
+}
+
+// fresh : Whether nothing has been recorded for the address on this chain yet
+func (st *nonceState) fresh() bool {
+	return st.Next == 0 && len(st.Released) == 0 && st.SyncedAt == nil
+}
+
+// release : Hands back a nonce which will not be used, so the account is not left with a gap
+func (st *nonceState) release(nonce uint64) error {
+	if nonce >= st.Next {
+		return fmt.Errorf("nonce %d has not been handed out", nonce)
+	}
+	for _, released := range st.Released {
+		if released == nonce {
+			return fmt.Errorf("nonce %d is already released", nonce)
+		}
+	}
+	st.Released = append(st.Released, nonce)
+	sort.Slice(st.Released, func(i, j int) bool { return st.Released[i] < st.Released[j] })
+	// Released nonces at the top of the range just lower Next
+	for len(st.Released) > 0 && st.Released[len(st.Released)-1] == st.Next-1 {
+		st.Released = st.Released[:len(st.Released)-1]
+		st.Next--
+	}
+	return nil
+}
+
+// sync : Adopts the node's pending nonce, dropping any record of nonces handed out past it
+func (st *nonceState) sync(pendingNonce uint64) {
+	now := time.Now().UTC()
+	st.Next = pendingNonce
+	st.Released = nil
+	st.SyncedAt = &now
+}
+
+func (b *backend) readNonceState(ctx context.Context, s logical.Storage, chainID int, pubAddress string) (*nonceState, error) {
+	entry, err := s.Get(ctx, nonceStoragePath(chainID, pubAddress))
+	if err != nil {
+		return nil, err
+	}
+	var state nonceState
+	if entry != nil {
+		if err := entry.DecodeJSON(&state); err != nil {
+			return nil, err
+		}
+	}
+	return &state, nil
+}
+
+func (b *backend) writeNonceState(ctx context.Context, s logical.Storage, chainID int, pubAddress string, state *nonceState) error {
+	entry, err := logical.StorageEntryJSON(nonceStoragePath(chainID, pubAddress), state)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// updateNonceState : Applies fn to the stored state for the address and chain, holding its lock so
+// concurrent signers never see the same state.  Nothing is written if fn fails.  Other addresses
+// are not held up while fn syncs with a node.
+func (b *backend) updateNonceState(ctx context.Context, s logical.Storage, chainID int, pubAddress string, fn func(state *nonceState) error) (*nonceState, error) {
+	lock := locksutil.LockForKey(b.nonceLocks, nonceStoragePath(chainID, pubAddress))
+	lock.Lock()
+	defer lock.Unlock()
+	state, err := b.readNonceState(ctx, s, chainID, pubAddress)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(state); err != nil {
+		return nil, err
+	}
+	if err := b.writeNonceState(ctx, s, chainID, pubAddress, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// assignNonce : Gives args a nonce when the caller left it out, otherwise records the one they chose.
+// The first nonce assigned for an address is synced from the chain's node when it has an rpc_url.
+func (b *backend) assignNonce(ctx context.Context, s logical.Storage, pubAddress string, args *txArgs) error {
+	_, err := b.updateNonceState(ctx, s, args.ChainID, pubAddress, func(state *nonceState) error {
+		if args.AutoNonce {
+			if args.Chain.RPCURL != "" && state.fresh() {
+				if err := b.syncNonceState(ctx, args.Chain, pubAddress, state); err != nil {
+					return err
+				}
+			}
+			args.Nonce = state.take()
+		} else {
+			args.nonceUse = state.use(args.Nonce)
+		}
+		return nil
+	})
+	return err
+}
+
+// peekNonce : The nonce assignNonce would give the address's next transaction, without reserving it
+func (b *backend) peekNonce(ctx context.Context, s logical.Storage, chain *ChainProfile, pubAddress string) (uint64, error) {
+	state, err := b.readNonceState(ctx, s, chain.ChainID, pubAddress)
+	if err != nil {
+		return 0, err
+	}
+	if chain.RPCURL != "" && state.fresh() {
+		node, err := chain.node()
+		if err != nil {
+			return 0, err
+		}
+		return node.PendingNonceAt(ctx, pubAddress)
+	}
+	return state.peek(), nil
+}
+
+// syncNonceState : Resets the state to the pending nonce of the chain's node
+func (b *backend) syncNonceState(ctx context.Context, chain *ChainProfile, pubAddress string, state *nonceState) error {
+	node, err := chain.node()
+	if err != nil {
+		return err
+	}
+	pendingNonce, err := node.PendingNonceAt(ctx, pubAddress)
+	if err != nil {
+		return fmt.Errorf("unable to fetch the pending nonce: %v", err)
+	}
+	state.sync(pendingNonce)
+	return nil
+}
+
+// unassignNonce : Hands back the nonce assignNonce chose or recorded, for when the transaction could not be signed
+func (b *backend) unassignNonce(ctx context.Context, s logical.Storage, pubAddress string, args *txArgs) error {
+	if !args.AutoNonce && args.nonceUse == nil {
+		return nil
+	}
+	_, err := b.updateNonceState(ctx, s, args.ChainID, pubAddress, func(state *nonceState) error {
+		if args.AutoNonce {
+			return state.release(args.Nonce)
+		}
+		return state.unuse(args.nonceUse)
+	})
+	if err == nil {
+		args.nonceUse = nil
+	}
+	return err
+}
+
+// signTx : Signs the transaction with the key, assigning its nonce first.  A nonce assigned
+// to a transaction which then fails to sign is released again.
+func (b *backend) signTx(ctx context.Context, s logical.Storage, key *SigningKey, args *txArgs) (jsonTx, rlpTx string, err error) {
+	pubAddress, err := key.Address()
+	if err != nil {
+		return "", "", err
+	}
+	if err := b.assignNonce(ctx, s, pubAddress, args); err != nil {
+		return "", "", fmt.Errorf("unable to assign a nonce: %v", err)
+	}
+	jsonTx, rlpTx, err = key.SignTx(args)
+	if err != nil {
+		if releaseErr := b.unassignNonce(ctx, s, pubAddress, args); releaseErr != nil {
+			return "", "", fmt.Errorf("%v, and the nonce could not be released: %v", err, releaseErr)
+		}
+		return "", "", err
+	}
+	return jsonTx, rlpTx, nil
+}
@@ -0,0 +1,42 @@
+package guardian
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNonceUseRollsBack(t *testing.T) {
+	cases := map[string]struct {
+		state     nonceState
+		nonce     uint64
+		takeAfter bool
+		want      nonceState
+	}{
+		"past next":            {nonceState{Next: 5}, 9, false, nonceState{Next: 5}},
+		"at next":              {nonceState{Next: 5}, 5, false, nonceState{Next: 5}},
+		"released":             {nonceState{Next: 5, Released: []uint64{2, 3}}, 3, false, nonceState{Next: 5, Released: []uint64{2, 3}}},
+		"already handed out":   {nonceState{Next: 5}, 4, false, nonceState{Next: 5}},
+		"handed out past it":   {nonceState{Next: 5}, 9, true, nonceState{Next: 11, Released: []uint64{9}}},
+		"released, then taken": {nonceState{Next: 5, Released: []uint64{2, 3}}, 3, true, nonceState{Next: 5, Released: []uint64{3}}},
+	}
+	for name, c := range cases {
+		state := c.state
+		state.Released = append([]uint64{}, c.state.Released...)
+		used := state.use(c.nonce)
+		if c.takeAfter {
+			state.take()
+		}
+		if used != nil {
+			if err := state.unuse(used); err != nil {
+				t.Errorf("%s: %v", name, err)
+				continue
+			}
+		}
+		if len(state.Released) == 0 && len(c.want.Released) == 0 {
+			state.Released, c.want.Released = nil, nil
+		}
+		if !reflect.DeepEqual(state, c.want) {
+			t.Errorf("%s: state is %+v, want %+v", name, state, c.want)
+		}
+	}
+}
@@ -3,9 +3,17 @@ package guardian
 import (
 	"context"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"math/big"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/eximchain/go-ethereum/accounts/abi"
+	"github.com/eximchain/go-ethereum/accounts/keystore"
 	"github.com/eximchain/go-ethereum/common"
+	"github.com/eximchain/go-ethereum/crypto"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -29,6 +37,25 @@ func keyFromTokenErrResp(err error) *logical.Response {
 	return cleanErrResp("Failed to load key from token accessor: ", err)
 }
 
+// messageFromData : Decodes `message` according to `encoding`
+func messageFromData(data *framework.FieldData) ([]byte, error) {
+	message := data.Get("message").(string)
+	switch data.Get("encoding").(string) {
+	case "utf8":
+		return []byte(message), nil
+	case "hex":
+		decoded, decodeErr := hex.DecodeString(strings.TrimPrefix(message, "0x"))
+		if decodeErr != nil {
+			return nil, fmt.Errorf("Unable to decode message from hex to bytes: %v", decodeErr)
+		}
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("encoding must be either utf8 or hex")
+}
+
+// maxListedAddresses : Upper bound on address_count, each address costs a key derivation
+const maxListedAddresses = 100
+
 func (b *backend) pathLogin(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	// Fetch login credentials
 	oktaUser := data.Get("okta_username").(string)
@@ -40,6 +67,13 @@ func (b *backend) pathLogin(ctx context.Context, req *logical.Request, data *fra
 		return cleanErrResp("Error building client: ", buildClientErr), buildClientErr
 	}
 
+	b.configLock.RLock()
+	defer b.configLock.RUnlock()
+	cfg, loadCfgErr := b.Config(ctx, req.Storage)
+	if loadCfgErr != nil {
+		return readConfigErrResp(loadCfgErr), loadCfgErr
+	}
+
 	// Do we have an account for them?
 	newUser, checkErr := client.isNewUser(oktaUser)
 	if checkErr != nil {
@@ -53,11 +87,28 @@ func (b *backend) pathLogin(ctx context.Context, req *logical.Request, data *fra
 			return cleanErrResp("Failed to verify whether user's Okta account exists:", oktaCheckErr), oktaCheckErr
 		}
 		if isOktaUser {
-			var createErr error
-			pubAddress, createErr = client.createEnduser(oktaUser)
-			if createErr != nil {
-				return cleanErrResp("Error creating user and keys: ", createErr), createErr
+			// Never replace keys which are already in storage, e.g. after migrate-keys
+			wallet, readWalletErr := b.readWallet(ctx, req.Storage, oktaUser)
+			if readWalletErr != nil {
+				return cleanErrResp("Error checking for existing keys: ", readWalletErr), readWalletErr
+			}
+			if wallet == nil {
+				var walletErr error
+				wallet, walletErr = NewWallet(cfg)
+				if walletErr != nil {
+					return cleanErrResp("Error creating keys: ", walletErr), walletErr
+				}
+				if storeErr := b.writeWallet(ctx, req.Storage, oktaUser, wallet); storeErr != nil {
+					return cleanErrResp("Error storing keys: ", storeErr), storeErr
+				}
+				if indexErr := b.writeWalletOwner(ctx, req.Storage, cfg, oktaUser, wallet); indexErr != nil {
+					return cleanErrResp("Error recording address owner: ", indexErr), indexErr
+				}
+			}
+			if createErr := client.createEnduser(oktaUser); createErr != nil {
+				return cleanErrResp("Error creating user: ", createErr), createErr
 			}
+			pubAddress = wallet.PublicAddressHex
 		} else {
 			return cleanErrResp("Username does not belong to Guardian's Okta organization, not creating account.", nil), nil
 		}
@@ -80,15 +131,11 @@ func (b *backend) pathLogin(ctx context.Context, req *logical.Request, data *fra
 		respData = map[string]interface{}{"client_token": singleToken}
 	} else {
 		if getAddress {
-			privKeyHex, fetchKeyErr := client.readKeyHexByUsername(oktaUser)
+			wallet, fetchKeyErr := b.readWalletByUsername(ctx, req.Storage, oktaUser)
 			if fetchKeyErr != nil {
 				return cleanErrResp("Error fetching your key: ", fetchKeyErr), fetchKeyErr
 			}
-			var buildAddressErr error
-			pubAddress, buildAddressErr = AddressFromHexKey(privKeyHex)
-			if buildAddressErr != nil {
-				return cleanErrResp("Error building address from the private key: ", buildAddressErr), buildAddressErr
-			}
+			pubAddress = wallet.PublicAddressHex
 		}
 		respData = map[string]interface{}{
 			"client_token": singleToken,
@@ -100,6 +147,8 @@ func (b *backend) pathLogin(ctx context.Context, req *logical.Request, data *fra
 
 func (b *backend) pathAuthorize(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	secretID, ok := data.GetOk("secret_id")
+	b.configLock.Lock()
+	defer b.configLock.Unlock()
 	cfg, loadCfgErr := b.Config(ctx, req.Storage)
 	if loadCfgErr != nil {
 		return readConfigErrResp(loadCfgErr), loadCfgErr
@@ -135,6 +184,23 @@ func (b *backend) pathAuthorize(ctx context.Context, req *logical.Request, data
 		return logical.ErrorResponse("Must provide an okta_token"), nil
 	}
 
+	exportEnabled, ok := data.GetOk("export_enabled")
+	if ok {
+		cfg.ExportEnabled = exportEnabled.(bool)
+	}
+
+	refuseRawSigning, ok := data.GetOk("refuse_raw_signing")
+	if ok {
+		cfg.RefuseRawSigning = refuseRawSigning.(bool)
+	}
+
+	// Keys are sealed under the master key, so it must exist before anyone logs in
+	if cfg.MasterKeyVersion == 0 {
+		if masterKeyErr := cfg.RotateMasterKey(); masterKeyErr != nil {
+			return cleanErrResp("Error generating the master key: ", masterKeyErr), masterKeyErr
+		}
+	}
+
 	jsonCfg, err := logical.StorageEntryJSON("config", cfg)
 	if err != nil {
 		return logical.ErrorResponse("Error making a StorageEntryJSON out of the config: " + err.Error()), err
@@ -154,11 +220,38 @@ func (b *backend) pathGetAddress(ctx context.Context, req *logical.Request, data
 		return cleanErrResp("Error building client: ", buildClientErr), buildClientErr
 	}
 
-	privKeyHex, readKeyErr := client.readKeyHexByEntityID(req.EntityID)
+	cfg, loadCfgErr := b.Config(ctx, req.Storage)
+	if loadCfgErr != nil {
+		return readConfigErrResp(loadCfgErr), loadCfgErr
+	}
+
+	addressCount := data.Get("address_count").(int)
+	if addressCount != 0 {
+		if addressCount < 0 || addressCount > maxListedAddresses {
+			return logical.ErrorResponse(fmt.Sprintf("address_count must be between 1 and %d", maxListedAddresses)), nil
+		}
+		wallet, readKeyErr := b.readWalletByEntityID(ctx, req, client)
+		if readKeyErr != nil {
+			return keyFromTokenErrResp(readKeyErr), readKeyErr
+		}
+		pubAddresses, listErr := wallet.Addresses(cfg, addressCount)
+		if listErr != nil {
+			return keyFromTokenErrResp(listErr), listErr
+		}
+		return &logical.Response{
+			Data: map[string]interface{}{"public_addresses": pubAddresses},
+		}, nil
+	}
+
+	addressIndex, indexErr := addressIndexFromData(data)
+	if indexErr != nil {
+		return logical.ErrorResponse(indexErr.Error()), nil
+	}
+	wallet, readKeyErr := b.readWalletByEntityID(ctx, req, client)
 	if readKeyErr != nil {
 		return keyFromTokenErrResp(readKeyErr), readKeyErr
 	}
-	pubAddress, getAddressErr := AddressFromHexKey(privKeyHex)
+	pubAddress, getAddressErr := wallet.Address(cfg, addressIndex)
 	if getAddressErr != nil {
 		return logical.ErrorResponse("Fail to derive address from private key: " + getAddressErr.Error()), getAddressErr
 	}
@@ -184,11 +277,23 @@ func (b *backend) pathSign(ctx context.Context, req *logical.Request, data *fram
 		return cleanErrResp("Error building client: ", buildClientErr), buildClientErr
 	}
 
-	privKeyHex, readKeyErr := client.readKeyHexByTokenAccessor(req.ClientTokenAccessor)
+	username, usernameErr := client.usernameFromTokenAccessor(req.ClientTokenAccessor)
+	if usernameErr != nil {
+		return keyFromTokenErrResp(usernameErr), usernameErr
+	}
+	// The hash could be any transaction's, so it is only signed for users no policy covers
+	violations, policyErr := b.rawSigningViolations(ctx, req.Storage, newPolicyUser(client, username))
+	if policyErr != nil {
+		return cleanErrResp("Unable to check policies, nothing was signed: ", policyErr), policyErr
+	}
+	if len(violations) > 0 {
+		return policyErrResp(violations), nil
+	}
+	key, readKeyErr := b.signingKey(ctx, req.Storage, username, data)
 	if readKeyErr != nil {
 		return keyFromTokenErrResp(readKeyErr), readKeyErr
 	}
-	sigBytes, err := SignWithHexKey(rawDataBytes, privKeyHex)
+	sigBytes, err := key.Sign(rawDataBytes)
 	if err != nil {
 		return logical.ErrorResponse("Failed to unmarshall key & sign: " + err.Error()), err
 	}
@@ -207,65 +312,154 @@ func (b *backend) pathSign(ctx context.Context, req *logical.Request, data *fram
 	}, nil
 }
 
-func (b *backend) pathSignTx(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Prepare args and return string
-	var signedTx string
-
-	// Fetch arguments, validate required ones, nil out ones which don't need to be there
-	nonce, hasNonce := data.GetOk("nonce")
-	to, hasTo := data.GetOk("to")
-	gasLimit, hasGasLimit := data.GetOk("gas_limit")
-	if !hasNonce || !hasTo || !hasGasLimit {
-		return cleanErrResp("Missing required information; please at least supply values for `to`, `nonce`, and `gas_limit`.", nil), nil
-	}
-
-	gasPrice, hasGasPrice := data.GetOk("gas_price")
-	amount, hasAmount := data.GetOk("amount")
-	var gasPriceValue *big.Int
-	var amountValue *big.Int
-	if !hasGasPrice {
-		gasPriceValue = nil
-	} else {
-		gasPriceValue = big.NewInt(int64(gasPrice.(int)))
+func (b *backend) pathSignMessage(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	message, decodeErr := messageFromData(data)
+	if decodeErr != nil {
+		return logical.ErrorResponse(decodeErr.Error()), nil
 	}
-	if !hasAmount {
-		amountValue = nil
-	} else {
-		amountValue = big.NewInt(int64(amount.(int)))
+
+	client, buildClientErr := ClientFromContext(b, ctx, req)
+	if buildClientErr != nil {
+		return cleanErrResp("Error building client: ", buildClientErr), buildClientErr
+	}
+
+	username, usernameErr := client.usernameFromTokenAccessor(req.ClientTokenAccessor)
+	if usernameErr != nil {
+		return keyFromTokenErrResp(usernameErr), usernameErr
+	}
+	key, readKeyErr := b.signingKey(ctx, req.Storage, username, data)
+	if readKeyErr != nil {
+		return keyFromTokenErrResp(readKeyErr), readKeyErr
+	}
+	sigBytes, signErr := key.SignMessage(message)
+	if signErr != nil {
+		return logical.ErrorResponse("Failed to unmarshall key & sign: " + signErr.Error()), signErr
+	}
+	pubAddress, addressErr := key.Address()
+	if addressErr != nil {
+		return cleanErrResp("Error building address from the private key: ", addressErr), addressErr
 	}
 
-	var txData string
-	txData = data.Get("data").(string)
-	if txData[:2] == "0x" {
-		txData = txData[2:]
+	freshToken, freshTokenErr := client.makeFreshToken(req.ClientTokenAccessor)
+	if freshTokenErr != nil {
+		return cleanErrResp("Unable to create a fresh_client_token after signing: ", freshTokenErr), freshTokenErr
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"signature":          "0x" + hex.EncodeToString(sigBytes),
+			"message_hash":       "0x" + hex.EncodeToString(HashPersonalMessage(message)),
+			"address":            pubAddress,
+			"fresh_client_token": freshToken,
+		},
+	}, nil
+}
+
+func (b *backend) pathSignTypedData(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	typedData, parseErr := ParseTypedData([]byte(data.Get("typed_data").(string)))
+	if parseErr != nil {
+		return cleanErrResp("Invalid typed_data: ", parseErr), nil
+	}
+	// Hash once up front, so values which don't match their types are reported as the user's error
+	if _, _, _, hashErr := typedData.HashTypedData(); hashErr != nil {
+		return cleanErrResp("Invalid typed_data: ", hashErr), nil
+	}
+
+	client, buildClientErr := ClientFromContext(b, ctx, req)
+	if buildClientErr != nil {
+		return cleanErrResp("Error building client: ", buildClientErr), buildClientErr
+	}
+
+	username, usernameErr := client.usernameFromTokenAccessor(req.ClientTokenAccessor)
+	if usernameErr != nil {
+		return keyFromTokenErrResp(usernameErr), usernameErr
+	}
+	key, readKeyErr := b.signingKey(ctx, req.Storage, username, data)
+	if readKeyErr != nil {
+		return keyFromTokenErrResp(readKeyErr), readKeyErr
+	}
+	sigBytes, domainSeparator, structHash, signErr := key.SignTypedData(typedData)
+	if signErr != nil {
+		return logical.ErrorResponse("Failed to unmarshall key & sign: " + signErr.Error()), signErr
+	}
+	pubAddress, addressErr := key.Address()
+	if addressErr != nil {
+		return cleanErrResp("Error building address from the private key: ", addressErr), addressErr
+	}
+
+	freshToken, freshTokenErr := client.makeFreshToken(req.ClientTokenAccessor)
+	if freshTokenErr != nil {
+		return cleanErrResp("Unable to create a fresh_client_token after signing: ", freshTokenErr), freshTokenErr
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"signature":          "0x" + hex.EncodeToString(sigBytes),
+			"domain_separator":   "0x" + hex.EncodeToString(domainSeparator),
+			"struct_hash":        "0x" + hex.EncodeToString(structHash),
+			"address":            pubAddress,
+			"fresh_client_token": freshToken,
+		},
+	}, nil
+}
+
+func (b *backend) pathSignContractCall(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if _, hasData := data.GetOk("data"); hasData {
+		return logical.ErrorResponse("`data` is built from `method` and `args`, do not provide it."), nil
+	}
+	abiJSON, hasABI := data.GetOk("abi")
+	abiName, hasABIName := data.GetOk("abi_name")
+	if hasABI == hasABIName {
+		return logical.ErrorResponse("Provide exactly one of `abi` or `abi_name`."), nil
+	}
+	if hasABIName {
+		stored, readErr := b.readStoredABI(ctx, req.Storage, abiName.(string))
+		if readErr != nil {
+			return cleanErrResp("Error reading the stored ABI: ", readErr), readErr
+		}
+		if stored == nil {
+			return logical.ErrorResponse(fmt.Sprintf("No ABI is stored as %s", abiName.(string))), nil
+		}
+		abiJSON = stored.ABI
+	}
+	contractABI, parseErr := ParseABI(abiJSON.(string))
+	if parseErr != nil {
+		return cleanErrResp("Invalid abi: ", parseErr), nil
+	}
+	calldata, method, encodeErr := EncodeCall(contractABI, data.Get("method").(string), data.Get("args").(string))
+	if encodeErr != nil {
+		return cleanErrResp("Unable to encode the call: ", encodeErr), nil
+	}
+	args, argsErr := txArgsFromData(data)
+	if argsErr != nil {
+		return cleanErrResp(argsErr.Error(), nil), nil
+	}
+	args.Data = hex.EncodeToString(calldata)
+	if chainErr := b.applyChain(ctx, req.Storage, args); chainErr != nil {
+		return cleanErrResp(chainErr.Error(), nil), nil
 	}
 
-	// Build a client to get their private key in hex
 	client, buildClientErr := ClientFromContext(b, ctx, req)
 	if buildClientErr != nil {
 		return cleanErrResp("Error building client: ", buildClientErr), buildClientErr
 	}
 
-	privKeyHex, readKeyErr := client.readKeyHexByTokenAccessor(req.ClientTokenAccessor)
+	username, usernameErr := client.usernameFromTokenAccessor(req.ClientTokenAccessor)
+	if usernameErr != nil {
+		return keyFromTokenErrResp(usernameErr), usernameErr
+	}
+	key, readKeyErr := b.signingKey(ctx, req.Storage, username, data)
 	if readKeyErr != nil {
 		return keyFromTokenErrResp(readKeyErr), readKeyErr
 	}
 
-	var signErr error
-	var signedRLP string
-	signedTx, signedRLP, signErr = SignTxWithHexKey(
-		data.Get("chain_id").(int),
-		privKeyHex,
-		txData,
-		common.HexToAddress(to.(string)),
-		uint64(nonce.(int)),
-		uint64(gasLimit.(int)),
-		amountValue,
-		gasPriceValue,
-	)
+	signedTx, signedRLP, violations, signErr := b.signTxWithinPolicy(ctx, req.Storage, newPolicyUser(client, username), key, args)
 	if signErr != nil {
 		return cleanErrResp("Unable to build and sign transaction: ", signErr), signErr
 	}
+	if len(violations) > 0 {
+		return policyErrResp(violations), nil
+	}
 
 	freshToken, freshTokenErr := client.makeFreshToken(req.ClientTokenAccessor)
 	if freshTokenErr != nil {
@@ -273,10 +467,1822 @@ func (b *backend) pathSignTx(ctx context.Context, req *logical.Request, data *fr
 	}
 
 	return &logical.Response{
-		Data: map[string]interface{}{
+		Data: args.withParsedValues(map[string]interface{}{
+			"method":             method.Sig(),
+			"calldata":           "0x" + args.Data,
 			"signed_tx_json":     signedTx,
 			"signed_tx_rlp":      signedRLP,
 			"fresh_client_token": freshToken,
+		}),
+	}, nil
+}
+
+func (b *backend) pathListABIs(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	names, listErr := req.Storage.List(ctx, abiStoragePrefix)
+	if listErr != nil {
+		return cleanErrResp("Unable to list ABIs: ", listErr), listErr
+	}
+	return logical.ListResponse(names), nil
+}
+
+func (b *backend) pathWriteABI(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	abiJSON := data.Get("abi").(string)
+	contractABI, parseErr := ParseABI(abiJSON)
+	if parseErr != nil {
+		return cleanErrResp("Invalid abi: ", parseErr), nil
+	}
+	if storeErr := b.writeStoredABI(ctx, req.Storage, name, &StoredABI{ABI: abiJSON}); storeErr != nil {
+		return cleanErrResp("Error storing the ABI: ", storeErr), storeErr
+	}
+	methods := []string{}
+	for _, method := range contractABI.Methods {
+		methods = append(methods, method.Sig())
+	}
+	sort.Strings(methods)
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":    name,
+			"methods": methods,
+		},
+	}, nil
+}
+
+func (b *backend) pathReadABI(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	stored, readErr := b.readStoredABI(ctx, req.Storage, data.Get("name").(string))
+	if readErr != nil {
+		return cleanErrResp("Error reading the ABI: ", readErr), readErr
+	}
+	if stored == nil {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{"abi": stored.ABI},
+	}, nil
+}
+
+func (b *backend) pathDeleteABI(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if deleteErr := req.Storage.Delete(ctx, abiStoragePrefix+data.Get("name").(string)); deleteErr != nil {
+		return cleanErrResp("Error deleting the ABI: ", deleteErr), deleteErr
+	}
+	return nil, nil
+}
+
+func (b *backend) pathSignBatch(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	items, itemsErr := batchItemsFromData(data)
+	if itemsErr != nil {
+		return cleanErrResp("Invalid batch, nothing was signed: ", itemsErr), nil
+	}
+	for i, item := range items {
+		if item.Tx == nil {
+			continue
+		}
+		if chainErr := b.applyChain(ctx, req.Storage, item.Tx); chainErr != nil {
+			return cleanErrResp("Invalid batch, nothing was signed: ", fmt.Errorf("item %d: %v", i, chainErr)), nil
+		}
+	}
+
+	client, buildClientErr := ClientFromContext(b, ctx, req)
+	if buildClientErr != nil {
+		return cleanErrResp("Error building client: ", buildClientErr), buildClientErr
+	}
+
+	username, usernameErr := client.usernameFromTokenAccessor(req.ClientTokenAccessor)
+	if usernameErr != nil {
+		return keyFromTokenErrResp(usernameErr), usernameErr
+	}
+	key, readKeyErr := b.signingKey(ctx, req.Storage, username, data)
+	if readKeyErr != nil {
+		return keyFromTokenErrResp(readKeyErr), readKeyErr
+	}
+	results, violations, signErr := b.signBatchWithinPolicy(ctx, req.Storage, newPolicyUser(client, username), key, items)
+	if signErr != nil {
+		return cleanErrResp("Unable to sign the batch, nothing was signed: ", signErr), signErr
+	}
+	if len(violations) > 0 {
+		return policyErrResp(violations), nil
+	}
+
+	freshToken, freshTokenErr := client.makeFreshToken(req.ClientTokenAccessor)
+	if freshTokenErr != nil {
+		return cleanErrResp("Unable to create a fresh_client_token after signing: ", freshTokenErr), freshTokenErr
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"results":            results,
+			"fresh_client_token": freshToken,
 		},
 	}, nil
 }
+
+func (b *backend) pathVerify(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sig, decodeErr := hex.DecodeString(strings.TrimPrefix(data.Get("signature").(string), "0x"))
+	if decodeErr != nil {
+		return logical.ErrorResponse("Unable to decode signature from hex to bytes: " + decodeErr.Error()), nil
+	}
+
+	hashStr, hasHash := data.GetOk("hash")
+	_, hasMessage := data.GetOk("message")
+	typedDataJSON, hasTypedData := data.GetOk("typed_data")
+	given := 0
+	for _, has := range []bool{hasHash, hasMessage, hasTypedData} {
+		if has {
+			given++
+		}
+	}
+	if given != 1 {
+		return logical.ErrorResponse("Provide exactly one of `hash`, `message` or `typed_data`."), nil
+	}
+
+	var hash []byte
+	switch {
+	case hasHash:
+		hash, decodeErr = hex.DecodeString(strings.TrimPrefix(hashStr.(string), "0x"))
+		if decodeErr != nil {
+			return logical.ErrorResponse("Unable to decode hash from hex to bytes: " + decodeErr.Error()), nil
+		}
+	case hasMessage:
+		message, messageErr := messageFromData(data)
+		if messageErr != nil {
+			return logical.ErrorResponse(messageErr.Error()), nil
+		}
+		hash = HashPersonalMessage(message)
+	case hasTypedData:
+		typedData, parseErr := ParseTypedData([]byte(typedDataJSON.(string)))
+		if parseErr != nil {
+			return cleanErrResp("Invalid typed_data: ", parseErr), nil
+		}
+		var hashErr error
+		hash, _, _, hashErr = typedData.HashTypedData()
+		if hashErr != nil {
+			return cleanErrResp("Invalid typed_data: ", hashErr), nil
+		}
+	}
+
+	pubKey, recoveryID, chainID, recoverErr := RecoverSigner(hash, sig)
+	if recoverErr != nil {
+		return cleanErrResp("Unable to recover the signer: ", recoverErr), nil
+	}
+	pubAddress := crypto.PubkeyToAddress(*pubKey)
+
+	respData := map[string]interface{}{
+		"address":     pubAddress.Hex(),
+		"public_key":  "0x" + hex.EncodeToString(crypto.FromECDSAPub(pubKey)),
+		"hash":        "0x" + hex.EncodeToString(hash),
+		"recovery_id": recoveryID,
+	}
+	if chainID != nil {
+		respData["chain_id"] = chainID.String()
+	}
+	if expected, hasExpected := data.GetOk("address"); hasExpected {
+		if !common.IsHexAddress(expected.(string)) {
+			return logical.ErrorResponse("address is not a valid hex address"), nil
+		}
+		respData["matches"] = common.HexToAddress(expected.(string)) == pubAddress
+	}
+	return &logical.Response{Data: respData}, nil
+}
+
+func (b *backend) pathSignTx(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	args, argsErr := txArgsFromData(data)
+	if argsErr != nil {
+		return cleanErrResp(argsErr.Error(), nil), nil
+	}
+	return b.signTxForToken(ctx, req, data, args)
+}
+
+func (b *backend) pathSignRawTx(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	args, argsErr := rawTxArgsFromData(data)
+	if argsErr != nil {
+		return cleanErrResp(argsErr.Error(), nil), nil
+	}
+	return b.signTxForToken(ctx, req, data, args)
+}
+
+func (b *backend) pathPreviewTx(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// The caller is identified before any chain or policy state is read
+	client, buildClientErr := ClientFromContext(b, ctx, req)
+	if buildClientErr != nil {
+		return cleanErrResp("Error building client: ", buildClientErr), buildClientErr
+	}
+	username, usernameErr := client.usernameFromTokenAccessor(req.ClientTokenAccessor)
+	if usernameErr != nil {
+		return keyFromTokenErrResp(usernameErr), usernameErr
+	}
+
+	_, hasRLP := data.GetOk("tx_rlp")
+	_, hasJSON := data.GetOk("tx_json")
+	var args *txArgs
+	var argsErr error
+	if hasRLP || hasJSON {
+		args, argsErr = rawTxArgsFromData(data)
+	} else {
+		args, argsErr = txArgsFromData(data)
+	}
+	if argsErr != nil {
+		return cleanErrResp(argsErr.Error(), nil), nil
+	}
+	if chainErr := b.applyChain(ctx, req.Storage, args); chainErr != nil {
+		return cleanErrResp(chainErr.Error(), nil), nil
+	}
+
+	// The key is only looked up for its stored address, it is never decrypted
+	key, readKeyErr := b.signingKey(ctx, req.Storage, username, data)
+	if readKeyErr != nil {
+		return keyFromTokenErrResp(readKeyErr), readKeyErr
+	}
+	sender := key.StoredAddress()
+	if args.AutoNonce && sender != "" {
+		nonce, peekErr := b.peekNonce(ctx, req.Storage, args.Chain, sender)
+		if peekErr != nil {
+			return cleanErrResp("Unable to look up the next nonce: ", peekErr), nil
+		}
+		args.Nonce = nonce
+	}
+	// Without a sender the nonce Guardian would assign is unknown, and so is the hash
+	nonceKnown := !args.AutoNonce || sender != ""
+
+	signingHash, hashErr := args.SigningHash()
+	if hashErr != nil {
+		return cleanErrResp("Unable to build the transaction: ", hashErr), nil
+	}
+	calldata, _ := hex.DecodeString(args.Data)
+
+	respData := args.previewFields()
+	respData["auto_nonce"] = args.AutoNonce
+	respData["signing_hash"] = "0x" + hex.EncodeToString(signingHash)
+	if !nonceKnown {
+		respData["nonce"] = nil
+		respData["signing_hash"] = nil
+	}
+
+	abiJSON, hasABI := data.GetOk("abi")
+	abiName, hasABIName := data.GetOk("abi_name")
+	if hasABI && hasABIName {
+		return logical.ErrorResponse("Provide at most one of `abi` or `abi_name`."), nil
+	}
+	if args.To != nil && len(calldata) > 0 {
+		var contractABI *abi.ABI
+		switch {
+		case hasABI:
+			parsed, parseErr := ParseABI(abiJSON.(string))
+			if parseErr != nil {
+				return cleanErrResp("Invalid abi: ", parseErr), nil
+			}
+			contractABI = parsed
+		case hasABIName:
+			stored, readErr := b.readStoredABI(ctx, req.Storage, abiName.(string))
+			if readErr != nil {
+				return cleanErrResp("Error reading the stored ABI: ", readErr), readErr
+			}
+			if stored == nil {
+				return logical.ErrorResponse(fmt.Sprintf("No ABI is stored as %s", abiName.(string))), nil
+			}
+			parsed, parseErr := ParseABI(stored.ABI)
+			if parseErr != nil {
+				return cleanErrResp("Invalid stored abi: ", parseErr), nil
+			}
+			contractABI = parsed
+		default:
+			foundName, found, findErr := b.findStoredABIForCall(ctx, req.Storage, calldata)
+			if findErr != nil {
+				return cleanErrResp("Error reading the stored ABIs: ", findErr), findErr
+			}
+			abiName, contractABI = foundName, found
+		}
+		if contractABI != nil {
+			method, decodedArgs, decodeErr := DecodeCall(contractABI, calldata)
+			if decodeErr != nil {
+				respData["decoded_call_error"] = decodeErr.Error()
+			} else {
+				respData["decoded_call"] = map[string]interface{}{
+					"abi_name": abiName,
+					"method":   method.Sig(),
+					"args":     decodedArgs,
+				}
+			}
+		}
+	}
+
+	respData["sender"] = nil
+	if sender != "" {
+		respData["sender"] = sender
+		if args.To == nil {
+			respData["contract_address"] = args.ContractAddress(sender)
+		}
+	}
+
+	violations, policyErr := b.txPolicyViolations(ctx, req.Storage, newPolicyUser(client, username), []*txArgs{args})
+	if policyErr != nil {
+		return cleanErrResp("Error checking policies: ", policyErr), policyErr
+	}
+	respData["policy_violations"] = violations
+
+	freshToken, freshTokenErr := client.makeFreshToken(req.ClientTokenAccessor)
+	if freshTokenErr != nil {
+		return cleanErrResp("Unable to create a fresh_client_token after previewing: ", freshTokenErr), freshTokenErr
+	}
+	respData["fresh_client_token"] = freshToken
+	return &logical.Response{Data: respData}, nil
+}
+
+// signTxForToken : Signs the transaction with the key the token's user chose, as sign-tx and sign-raw-tx respond
+func (b *backend) signTxForToken(ctx context.Context, req *logical.Request, data *framework.FieldData, args *txArgs) (*logical.Response, error) {
+	if chainErr := b.applyChain(ctx, req.Storage, args); chainErr != nil {
+		return cleanErrResp(chainErr.Error(), nil), nil
+	}
+
+	// Build a client to get their private key in hex
+	client, buildClientErr := ClientFromContext(b, ctx, req)
+	if buildClientErr != nil {
+		return cleanErrResp("Error building client: ", buildClientErr), buildClientErr
+	}
+
+	username, usernameErr := client.usernameFromTokenAccessor(req.ClientTokenAccessor)
+	if usernameErr != nil {
+		return keyFromTokenErrResp(usernameErr), usernameErr
+	}
+	key, readKeyErr := b.signingKey(ctx, req.Storage, username, data)
+	if readKeyErr != nil {
+		return keyFromTokenErrResp(readKeyErr), readKeyErr
+	}
+
+	// Check the transaction can be broadcast before a nonce is spent on it
+	broadcast := data.Get("broadcast").(bool)
+	var node *chainNode
+	if broadcast {
+		if args.Private {
+			return logical.ErrorResponse("Private transactions must be sent with eth_sendRawPrivateTransaction along with their privateFor recipients, so cannot be broadcast."), nil
+		}
+		var nodeErr error
+		node, nodeErr = args.Chain.node()
+		if nodeErr != nil {
+			return cleanErrResp("Unable to broadcast: ", nodeErr), nil
+		}
+	}
+
+	signedTx, signedRLP, violations, signErr := b.signTxWithinPolicy(ctx, req.Storage, newPolicyUser(client, username), key, args)
+	if signErr != nil {
+		return cleanErrResp("Unable to build and sign transaction: ", signErr), signErr
+	}
+	if len(violations) > 0 {
+		return policyErrResp(violations), nil
+	}
+
+	freshToken, freshTokenErr := client.makeFreshToken(req.ClientTokenAccessor)
+	if freshTokenErr != nil {
+		return cleanErrResp("Unable to create a fresh_client_token after signing: ", freshTokenErr), freshTokenErr
+	}
+
+	resp := &logical.Response{
+		Data: args.withParsedValues(map[string]interface{}{
+			"signed_tx_json":     signedTx,
+			"signed_tx_rlp":      signedRLP,
+			"fresh_client_token": freshToken,
+		}),
+	}
+	if args.To == nil {
+		sender, addressErr := key.Address()
+		if addressErr != nil {
+			return cleanErrResp("Error building address from the private key: ", addressErr), addressErr
+		}
+		resp.Data["contract_address"] = args.ContractAddress(sender)
+	}
+	if broadcast {
+		// The transaction is signed either way, so a refusal is reported alongside it rather than as an error
+		txHash, sendErr := node.SendRawTransaction(ctx, signedRLP)
+		if sendErr != nil {
+			resp.Data["broadcast_error"] = sendErr.Error()
+		} else {
+			resp.Data["tx_hash"] = txHash
+		}
+	}
+	return resp, nil
+}
+
+func (b *backend) pathBroadcast(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	signedTx := data.Get("signed_tx").(string)
+	if _, decodeErr := hex.DecodeString(strings.TrimPrefix(signedTx, "0x")); decodeErr != nil || len(signedTx) == 0 {
+		return logical.ErrorResponse("`signed_tx` must be the hex encoded signed transaction, as sign-tx returns it in signed_tx_rlp."), nil
+	}
+	if !strings.HasPrefix(signedTx, "0x") {
+		signedTx = "0x" + signedTx
+	}
+	chain, chainErr := b.resolveChain(ctx, req.Storage, data.Get("chain").(string), data.Get("chain_id").(int))
+	if chainErr != nil {
+		return cleanErrResp(chainErr.Error(), nil), nil
+	}
+	node, nodeErr := chain.node()
+	if nodeErr != nil {
+		return cleanErrResp("Unable to broadcast: ", nodeErr), nil
+	}
+	client, buildClientErr := ClientFromContext(b, ctx, req)
+	if buildClientErr != nil {
+		return cleanErrResp("Error building client: ", buildClientErr), buildClientErr
+	}
+	// The token is spent whether or not the node accepts the transaction
+	freshToken, freshTokenErr := client.makeFreshToken(req.ClientTokenAccessor)
+	if freshTokenErr != nil {
+		return cleanErrResp("Unable to create a fresh_client_token: ", freshTokenErr), freshTokenErr
+	}
+	txHash, sendErr := node.SendRawTransaction(ctx, signedTx)
+	if sendErr != nil {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"broadcast_error":    sendErr.Error(),
+				"fresh_client_token": freshToken,
+			},
+		}, nil
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"tx_hash":            txHash,
+			"fresh_client_token": freshToken,
+		},
+	}, nil
+}
+
+func (b *backend) pathMigrateKeys(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	deleteSource := data.Get("delete_source").(bool)
+
+	b.configLock.RLock()
+	defer b.configLock.RUnlock()
+	cfg, loadCfgErr := b.Config(ctx, req.Storage)
+	if loadCfgErr != nil {
+		return readConfigErrResp(loadCfgErr), loadCfgErr
+	}
+	client, makeClientErr := cfg.Client()
+	if makeClientErr != nil {
+		return makeClientErrResp(makeClientErr), makeClientErr
+	}
+
+	usernames, listErr := client.listKeySecrets()
+	if listErr != nil {
+		return cleanErrResp("Unable to list the /keys mount: ", listErr), listErr
+	}
+
+	migrated := []string{}
+	skipped := []string{}
+	for _, username := range usernames {
+		existing, readErr := b.readWallet(ctx, req.Storage, username)
+		if readErr != nil {
+			return cleanErrResp(fmt.Sprintf("Error checking storage for %s: ", username), readErr), readErr
+		}
+		if existing != nil {
+			skipped = append(skipped, username)
+			continue
+		}
+		keyData, fetchErr := client.readKeySecretByUsername(username)
+		if fetchErr != nil {
+			return cleanErrResp(fmt.Sprintf("Error reading /keys/%s: ", username), fetchErr), fetchErr
+		}
+		wallet, convertErr := walletFromKeySecret(cfg, keyData)
+		if convertErr != nil {
+			return cleanErrResp(fmt.Sprintf("Error importing /keys/%s: ", username), convertErr), convertErr
+		}
+		if storeErr := b.writeWallet(ctx, req.Storage, username, wallet); storeErr != nil {
+			return cleanErrResp(fmt.Sprintf("Error storing key for %s: ", username), storeErr), storeErr
+		}
+		if indexErr := b.writeWalletOwner(ctx, req.Storage, cfg, username, wallet); indexErr != nil {
+			return cleanErrResp(fmt.Sprintf("Error recording address owner for %s: ", username), indexErr), indexErr
+		}
+		if deleteSource {
+			if deleteErr := client.deleteKeySecret(username); deleteErr != nil {
+				return cleanErrResp(fmt.Sprintf("Imported %s but could not delete /keys/%s: ", username, username), deleteErr), deleteErr
+			}
+		}
+		migrated = append(migrated, username)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"migrated": migrated,
+			"skipped":  skipped,
+		},
+	}, nil
+}
+
+func (b *backend) pathListKeys(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	client, buildClientErr := ClientFromContext(b, ctx, req)
+	if buildClientErr != nil {
+		return cleanErrResp("Error building client: ", buildClientErr), buildClientErr
+	}
+	username, usernameErr := client.usernameFromTokenAccessor(req.ClientTokenAccessor)
+	if usernameErr != nil {
+		return keyFromTokenErrResp(usernameErr), usernameErr
+	}
+
+	names, listErr := b.listNamedKeys(ctx, req.Storage, username)
+	if listErr != nil {
+		return cleanErrResp("Unable to list your keys: ", listErr), listErr
+	}
+
+	freshToken, freshTokenErr := client.makeFreshToken(req.ClientTokenAccessor)
+	if freshTokenErr != nil {
+		return cleanErrResp("Unable to create a fresh_client_token: ", freshTokenErr), freshTokenErr
+	}
+
+	resp := logical.ListResponse(names)
+	resp.Data["fresh_client_token"] = freshToken
+	return resp, nil
+}
+
+func (b *backend) pathCreateKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	client, buildClientErr := ClientFromContext(b, ctx, req)
+	if buildClientErr != nil {
+		return cleanErrResp("Error building client: ", buildClientErr), buildClientErr
+	}
+	username, usernameErr := client.usernameFromTokenAccessor(req.ClientTokenAccessor)
+	if usernameErr != nil {
+		return keyFromTokenErrResp(usernameErr), usernameErr
+	}
+
+	// Held until the key is stored, so a concurrent create cannot take the name meanwhile
+	unlock := b.lockKeyPaths(namedKeyStoragePrefix(username) + name)
+	defer unlock()
+	existing, readErr := b.readNamedKey(ctx, req.Storage, username, name)
+	if readErr != nil {
+		return cleanErrResp("Error checking for an existing key: ", readErr), readErr
+	}
+	if existing != nil {
+		return logical.ErrorResponse(fmt.Sprintf("You already have a key named %s", name)), nil
+	}
+
+	privKeyHex, pubAddress, createErr := CreateKey()
+	if createErr != nil {
+		return cleanErrResp("Error creating key: ", createErr), createErr
+	}
+	b.configLock.RLock()
+	defer b.configLock.RUnlock()
+	cfg, loadCfgErr := b.Config(ctx, req.Storage)
+	if loadCfgErr != nil {
+		return readConfigErrResp(loadCfgErr), loadCfgErr
+	}
+	key, sealErr := NewNamedKey(cfg, privKeyHex, pubAddress)
+	if sealErr != nil {
+		return cleanErrResp("Error sealing key: ", sealErr), sealErr
+	}
+	if storeErr := b.writeNamedKey(ctx, req.Storage, username, name, key); storeErr != nil {
+		return cleanErrResp("Error storing key: ", storeErr), storeErr
+	}
+	if indexErr := b.writeAddressOwner(ctx, req.Storage, pubAddress, &addressOwner{Username: username, KeyName: name}); indexErr != nil {
+		return cleanErrResp("Error recording address owner: ", indexErr), indexErr
+	}
+
+	freshToken, freshTokenErr := client.makeFreshToken(req.ClientTokenAccessor)
+	if freshTokenErr != nil {
+		return cleanErrResp("Unable to create a fresh_client_token: ", freshTokenErr), freshTokenErr
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":               name,
+			"public_address":     pubAddress,
+			"fresh_client_token": freshToken,
+		},
+	}, nil
+}
+
+func (b *backend) pathImportKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	rawKey, hasRawKey := data.GetOk("private_key")
+	keystoreJSON, hasKeystore := data.GetOk("keystore_json")
+	if hasRawKey == hasKeystore {
+		return logical.ErrorResponse("Provide exactly one of `private_key` or `keystore_json`."), nil
+	}
+
+	var privKeyHex string
+	if hasRawKey {
+		privKeyHex = NormalizeHexKey(rawKey.(string))
+	} else {
+		var decryptErr error
+		privKeyHex, decryptErr = DecryptKeystoreV3([]byte(keystoreJSON.(string)), data.Get("passphrase").(string))
+		if decryptErr != nil {
+			return cleanErrResp("Unable to decrypt keystore_json: ", decryptErr), nil
+		}
+	}
+	pubAddress, addressErr := AddressFromHexKey(privKeyHex)
+	if addressErr != nil {
+		return cleanErrResp("Not a valid secp256k1 private key: ", addressErr), nil
+	}
+
+	client, buildClientErr := ClientFromContext(b, ctx, req)
+	if buildClientErr != nil {
+		return cleanErrResp("Error building client: ", buildClientErr), buildClientErr
+	}
+	username, usernameErr := client.usernameFromTokenAccessor(req.ClientTokenAccessor)
+	if usernameErr != nil {
+		return keyFromTokenErrResp(usernameErr), usernameErr
+	}
+
+	// Held until the key and its owner are stored, so concurrent imports cannot both find the name and address free
+	unlock := b.lockKeyPaths(namedKeyStoragePrefix(username)+name, addressOwnerStoragePath(pubAddress))
+	defer unlock()
+	existing, readErr := b.readNamedKey(ctx, req.Storage, username, name)
+	if readErr != nil {
+		return cleanErrResp("Error checking for an existing key: ", readErr), readErr
+	}
+	if existing != nil {
+		return logical.ErrorResponse(fmt.Sprintf("You already have a key named %s", name)), nil
+	}
+	owner, ownerErr := b.readAddressOwner(ctx, req.Storage, pubAddress)
+	if ownerErr != nil {
+		return cleanErrResp("Error checking who holds this address: ", ownerErr), ownerErr
+	}
+	if owner != nil {
+		if owner.Username != username {
+			return logical.ErrorResponse(fmt.Sprintf("Address %s is already held by another user, not importing.", pubAddress)), nil
+		}
+		return logical.ErrorResponse(fmt.Sprintf("You already hold address %s, not importing it twice.", pubAddress)), nil
+	}
+
+	b.configLock.RLock()
+	defer b.configLock.RUnlock()
+	cfg, loadCfgErr := b.Config(ctx, req.Storage)
+	if loadCfgErr != nil {
+		return readConfigErrResp(loadCfgErr), loadCfgErr
+	}
+	key, sealErr := NewNamedKey(cfg, privKeyHex, pubAddress)
+	if sealErr != nil {
+		return cleanErrResp("Error sealing key: ", sealErr), sealErr
+	}
+	if storeErr := b.writeNamedKey(ctx, req.Storage, username, name, key); storeErr != nil {
+		return cleanErrResp("Error storing key: ", storeErr), storeErr
+	}
+	if indexErr := b.writeAddressOwner(ctx, req.Storage, pubAddress, &addressOwner{Username: username, KeyName: name}); indexErr != nil {
+		return cleanErrResp("Error recording address owner: ", indexErr), indexErr
+	}
+
+	freshToken, freshTokenErr := client.makeFreshToken(req.ClientTokenAccessor)
+	if freshTokenErr != nil {
+		return cleanErrResp("Unable to create a fresh_client_token: ", freshTokenErr), freshTokenErr
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":               name,
+			"public_address":     pubAddress,
+			"fresh_client_token": freshToken,
+		},
+	}, nil
+}
+
+func (b *backend) pathReadKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	client, buildClientErr := ClientFromContext(b, ctx, req)
+	if buildClientErr != nil {
+		return cleanErrResp("Error building client: ", buildClientErr), buildClientErr
+	}
+	username, usernameErr := client.usernameFromTokenAccessor(req.ClientTokenAccessor)
+	if usernameErr != nil {
+		return keyFromTokenErrResp(usernameErr), usernameErr
+	}
+
+	key, readErr := b.readNamedKey(ctx, req.Storage, username, name)
+	if readErr != nil {
+		return cleanErrResp("Error reading key: ", readErr), readErr
+	}
+	if key == nil {
+		return logical.ErrorResponse(fmt.Sprintf("You have no key named %s", name)), nil
+	}
+
+	freshToken, freshTokenErr := client.makeFreshToken(req.ClientTokenAccessor)
+	if freshTokenErr != nil {
+		return cleanErrResp("Unable to create a fresh_client_token: ", freshTokenErr), freshTokenErr
+	}
+
+	respData := map[string]interface{}{
+		"name":               name,
+		"public_address":     key.PublicAddressHex,
+		"created_at":         key.CreatedAt,
+		"archived":           key.Archived(),
+		"fresh_client_token": freshToken,
+	}
+	if key.Archived() {
+		respData["archived_at"] = *key.ArchivedAt
+	}
+	return &logical.Response{Data: respData}, nil
+}
+
+func (b *backend) pathArchiveKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	client, buildClientErr := ClientFromContext(b, ctx, req)
+	if buildClientErr != nil {
+		return cleanErrResp("Error building client: ", buildClientErr), buildClientErr
+	}
+	username, usernameErr := client.usernameFromTokenAccessor(req.ClientTokenAccessor)
+	if usernameErr != nil {
+		return keyFromTokenErrResp(usernameErr), usernameErr
+	}
+
+	key, readErr := b.readNamedKey(ctx, req.Storage, username, name)
+	if readErr != nil {
+		return cleanErrResp("Error reading key: ", readErr), readErr
+	}
+	if key == nil {
+		return logical.ErrorResponse(fmt.Sprintf("You have no key named %s", name)), nil
+	}
+	if !key.Archived() {
+		archivedAt := time.Now().UTC()
+		key.ArchivedAt = &archivedAt
+		if storeErr := b.writeNamedKey(ctx, req.Storage, username, name, key); storeErr != nil {
+			return cleanErrResp("Error archiving key: ", storeErr), storeErr
+		}
+	}
+
+	freshToken, freshTokenErr := client.makeFreshToken(req.ClientTokenAccessor)
+	if freshTokenErr != nil {
+		return cleanErrResp("Unable to create a fresh_client_token: ", freshTokenErr), freshTokenErr
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":               name,
+			"archived_at":        *key.ArchivedAt,
+			"fresh_client_token": freshToken,
+		},
+	}, nil
+}
+
+func (b *backend) pathExportKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	cfg, loadCfgErr := b.Config(ctx, req.Storage)
+	if loadCfgErr != nil {
+		return readConfigErrResp(loadCfgErr), loadCfgErr
+	}
+	if !cfg.ExportEnabled {
+		return logical.ErrorResponse("Key export is disabled, an admin must first write export_enabled=true to authorize."), nil
+	}
+
+	username := data.Get("username").(string)
+	passphrase := data.Get("passphrase").(string)
+	if username == "" || passphrase == "" {
+		return logical.ErrorResponse("Must provide a `username` and a `passphrase` to encrypt the key under."), nil
+	}
+
+	var material KeyMaterial
+	addressIndex := 0
+	keyName, hasKeyName := data.GetOk("key_name")
+	if hasKeyName {
+		// Archived keys are still exportable, recovering them is one reason to export
+		key, readErr := b.readNamedKey(ctx, req.Storage, username, keyName.(string))
+		if readErr != nil {
+			return cleanErrResp("Error reading key: ", readErr), readErr
+		}
+		if key == nil {
+			return logical.ErrorResponse(fmt.Sprintf("%s has no key named %s", username, keyName.(string))), nil
+		}
+		material = key.KeyMaterial
+	} else {
+		var indexErr error
+		addressIndex, indexErr = addressIndexFromData(data)
+		if indexErr != nil {
+			return logical.ErrorResponse(indexErr.Error()), nil
+		}
+		wallet, readErr := b.readWalletByUsername(ctx, req.Storage, username)
+		if readErr != nil {
+			return cleanErrResp("Error reading keys: ", readErr), readErr
+		}
+		material = wallet.KeyMaterial
+	}
+
+	var keyJSON []byte
+	var pubAddress string
+	exportErr := material.withKeyHex(cfg, addressIndex, func(privKeyHex string) error {
+		var err error
+		if keyJSON, err = EncryptKeystoreV3(privKeyHex, passphrase, keystore.StandardScryptN, keystore.StandardScryptP); err != nil {
+			return err
+		}
+		pubAddress, err = AddressFromHexKey(privKeyHex)
+		return err
+	})
+	if exportErr != nil {
+		return cleanErrResp("Unable to encrypt key: ", exportErr), exportErr
+	}
+
+	detail := fmt.Sprintf("address_index=%d", data.Get("address_index").(int))
+	if hasKeyName {
+		detail = "key_name=" + keyName.(string)
+	}
+	auditID, auditErr := b.recordAuditEvent(ctx, req, &AuditEvent{
+		Operation: "export",
+		Username:  username,
+		Address:   pubAddress,
+		Detail:    detail,
+	})
+	if auditErr != nil {
+		return cleanErrResp("Unable to record the export in the audit trail, not exporting: ", auditErr), auditErr
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"public_address": pubAddress,
+			"keystore_json":  string(keyJSON),
+			"audit_id":       auditID,
+		},
+	}, nil
+}
+
+func (b *backend) pathListAuditEvents(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ids, listErr := req.Storage.List(ctx, auditStoragePrefix)
+	if listErr != nil {
+		return cleanErrResp("Unable to list audit events: ", listErr), listErr
+	}
+	return logical.ListResponse(ids), nil
+}
+
+func (b *backend) pathReadAuditEvent(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	event, readErr := b.readAuditEvent(ctx, req.Storage, data.Get("id").(string))
+	if readErr != nil {
+		return cleanErrResp("Unable to read audit event: ", readErr), readErr
+	}
+	if event == nil {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"time":      event.Time,
+			"operation": event.Operation,
+			"actor":     event.Actor,
+			"username":  event.Username,
+			"address":   event.Address,
+			"detail":    event.Detail,
+		},
+	}, nil
+}
+
+func (b *backend) pathRotateKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.configLock.RLock()
+	defer b.configLock.RUnlock()
+	cfg, loadCfgErr := b.Config(ctx, req.Storage)
+	if loadCfgErr != nil {
+		return readConfigErrResp(loadCfgErr), loadCfgErr
+	}
+	client, makeClientErr := cfg.Client()
+	if makeClientErr != nil {
+		return makeClientErrResp(makeClientErr), makeClientErr
+	}
+	username, usernameErr := client.usernameFromTokenAccessor(req.ClientTokenAccessor)
+	if usernameErr != nil {
+		return keyFromTokenErrResp(usernameErr), usernameErr
+	}
+
+	var version int
+	var pubAddress, previousAddress string
+	var rotatedWallet *Wallet
+	keyName, hasKeyName := data.GetOk("key_name")
+	if hasKeyName {
+		key, readErr := b.readNamedKey(ctx, req.Storage, username, keyName.(string))
+		if readErr != nil {
+			return cleanErrResp("Error reading key: ", readErr), readErr
+		}
+		if key == nil {
+			return logical.ErrorResponse(fmt.Sprintf("You have no key named %s", keyName.(string))), nil
+		}
+		if key.Archived() {
+			return logical.ErrorResponse(fmt.Sprintf("Key %s is archived and cannot be rotated", keyName.(string))), nil
+		}
+		previousAddress = key.PublicAddressHex
+		if rotateErr := key.Rotate(cfg); rotateErr != nil {
+			return cleanErrResp("Error generating the new key: ", rotateErr), rotateErr
+		}
+		if storeErr := b.writeNamedKey(ctx, req.Storage, username, keyName.(string), key); storeErr != nil {
+			return cleanErrResp("Error storing the rotated key: ", storeErr), storeErr
+		}
+		version, pubAddress = key.Version(), key.PublicAddressHex
+	} else {
+		wallet, readErr := b.readWalletByUsername(ctx, req.Storage, username)
+		if readErr != nil {
+			return cleanErrResp("Error reading keys: ", readErr), readErr
+		}
+		previousAddress = wallet.PublicAddressHex
+		if rotateErr := wallet.Rotate(cfg); rotateErr != nil {
+			return cleanErrResp("Error generating the new wallet: ", rotateErr), rotateErr
+		}
+		if storeErr := b.writeWallet(ctx, req.Storage, username, wallet); storeErr != nil {
+			return cleanErrResp("Error storing the rotated wallet: ", storeErr), storeErr
+		}
+		version, pubAddress, rotatedWallet = wallet.Version(), wallet.PublicAddressHex, wallet
+	}
+
+	var indexErr error
+	if hasKeyName {
+		indexErr = b.writeAddressOwner(ctx, req.Storage, pubAddress, &addressOwner{Username: username, KeyName: keyName.(string)})
+	} else {
+		indexErr = b.writeWalletOwner(ctx, req.Storage, cfg, username, rotatedWallet)
+	}
+	if indexErr != nil {
+		return cleanErrResp("Error recording address owner: ", indexErr), indexErr
+	}
+	if _, auditErr := b.recordAuditEvent(ctx, req, &AuditEvent{
+		Operation: "rotate",
+		Username:  username,
+		Address:   pubAddress,
+		Detail:    fmt.Sprintf("version=%d previous_address=%s", version, previousAddress),
+	}); auditErr != nil {
+		return cleanErrResp("Unable to record the rotation in the audit trail: ", auditErr), auditErr
+	}
+
+	freshToken, freshTokenErr := client.makeFreshToken(req.ClientTokenAccessor)
+	if freshTokenErr != nil {
+		return cleanErrResp("Unable to create a fresh_client_token: ", freshTokenErr), freshTokenErr
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"version":            version,
+			"public_address":     pubAddress,
+			"previous_address":   previousAddress,
+			"fresh_client_token": freshToken,
+		},
+	}, nil
+}
+
+func (b *backend) pathKeyVersions(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	client, buildClientErr := ClientFromContext(b, ctx, req)
+	if buildClientErr != nil {
+		return cleanErrResp("Error building client: ", buildClientErr), buildClientErr
+	}
+	username, usernameErr := client.usernameFromTokenAccessor(req.ClientTokenAccessor)
+	if usernameErr != nil {
+		return keyFromTokenErrResp(usernameErr), usernameErr
+	}
+
+	var archived []ArchivedKey
+	var current map[string]interface{}
+	keyName, hasKeyName := data.GetOk("key_name")
+	if hasKeyName {
+		key, readErr := b.readNamedKey(ctx, req.Storage, username, keyName.(string))
+		if readErr != nil {
+			return cleanErrResp("Error reading key: ", readErr), readErr
+		}
+		if key == nil {
+			return logical.ErrorResponse(fmt.Sprintf("You have no key named %s", keyName.(string))), nil
+		}
+		archived = key.ArchivedVersions
+		current = map[string]interface{}{"version": key.Version(), "public_address": key.PublicAddressHex, "created_at": key.CreatedAt}
+	} else {
+		wallet, readErr := b.readWalletByUsername(ctx, req.Storage, username)
+		if readErr != nil {
+			return cleanErrResp("Error reading keys: ", readErr), readErr
+		}
+		archived = wallet.ArchivedVersions
+		current = map[string]interface{}{"version": wallet.Version(), "public_address": wallet.PublicAddressHex, "created_at": wallet.CreatedAt}
+	}
+
+	versions := []map[string]interface{}{}
+	for _, version := range archived {
+		versions = append(versions, map[string]interface{}{
+			"version":        version.Version,
+			"public_address": version.PublicAddressHex,
+			"created_at":     version.CreatedAt,
+			"retired_at":     version.RetiredAt,
+		})
+	}
+	versions = append(versions, current)
+
+	freshToken, freshTokenErr := client.makeFreshToken(req.ClientTokenAccessor)
+	if freshTokenErr != nil {
+		return cleanErrResp("Unable to create a fresh_client_token: ", freshTokenErr), freshTokenErr
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"versions":           versions,
+			"fresh_client_token": freshToken,
+		},
+	}, nil
+}
+
+func (b *backend) pathSweep(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	username := data.Get("username").(string)
+	if username == "" {
+		return logical.ErrorResponse("Must provide the `username` whose key should sign."), nil
+	}
+	if _, hasKeyVersion := data.GetOk("key_version"); !hasKeyVersion {
+		return logical.ErrorResponse("Must provide the `key_version` to sign with."), nil
+	}
+	args, argsErr := txArgsFromData(data)
+	if argsErr != nil {
+		return cleanErrResp(argsErr.Error(), nil), nil
+	}
+	if chainErr := b.applyChain(ctx, req.Storage, args); chainErr != nil {
+		return cleanErrResp(chainErr.Error(), nil), nil
+	}
+
+	key, readKeyErr := b.signingKey(ctx, req.Storage, username, data)
+	if readKeyErr != nil {
+		return cleanErrResp("Failed to load key: ", readKeyErr), readKeyErr
+	}
+	pubAddress, addressErr := key.Address()
+	if addressErr != nil {
+		return cleanErrResp("Error building address from the private key: ", addressErr), addressErr
+	}
+
+	signedTx, signedRLP, signErr := b.signTx(ctx, req.Storage, key, args)
+	if signErr != nil {
+		return cleanErrResp("Unable to build and sign transaction: ", signErr), signErr
+	}
+
+	auditID, auditErr := b.recordAuditEvent(ctx, req, &AuditEvent{
+		Operation: "sweep",
+		Username:  username,
+		Address:   pubAddress,
+		Detail:    fmt.Sprintf("key_version=%d to=%s nonce=%d", data.Get("key_version").(int), args.To.Hex(), args.Nonce),
+	})
+	if auditErr != nil {
+		return cleanErrResp("Unable to record the sweep in the audit trail, not returning it: ", auditErr), auditErr
+	}
+
+	return &logical.Response{
+		Data: args.withParsedValues(map[string]interface{}{
+			"public_address": pubAddress,
+			"signed_tx_json": signedTx,
+			"signed_tx_rlp":  signedRLP,
+			"audit_id":       auditID,
+		}),
+	}, nil
+}
+
+func (b *backend) pathRotateMasterKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.configLock.Lock()
+	defer b.configLock.Unlock()
+	cfg, loadCfgErr := b.Config(ctx, req.Storage)
+	if loadCfgErr != nil {
+		return readConfigErrResp(loadCfgErr), loadCfgErr
+	}
+	if rotateErr := cfg.RotateMasterKey(); rotateErr != nil {
+		return cleanErrResp("Error generating the master key: ", rotateErr), rotateErr
+	}
+	if storeErr := b.writeConfig(ctx, req.Storage, cfg); storeErr != nil {
+		return cleanErrResp("Error saving the config StorageEntry: ", storeErr), storeErr
+	}
+	if _, auditErr := b.recordAuditEvent(ctx, req, &AuditEvent{
+		Operation: "master-key-rotate",
+		Detail:    fmt.Sprintf("version=%d", cfg.MasterKeyVersion),
+	}); auditErr != nil {
+		return cleanErrResp("Unable to record the rotation in the audit trail: ", auditErr), auditErr
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"master_key_version":  cfg.MasterKeyVersion,
+			"master_key_versions": cfg.MasterKeyVersions(),
+		},
+	}, nil
+}
+
+func (b *backend) pathRewrapKeys(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	deleteOldVersions := data.Get("delete_old_versions").(bool)
+	b.configLock.Lock()
+	defer b.configLock.Unlock()
+	cfg, loadCfgErr := b.Config(ctx, req.Storage)
+	if loadCfgErr != nil {
+		return readConfigErrResp(loadCfgErr), loadCfgErr
+	}
+	if cfg.MasterKeyVersion == 0 {
+		return logical.ErrorResponse("No master key is configured yet, write to master-key/rotate first."), nil
+	}
+
+	rewrapped := 0
+	usernames, listErr := b.listWallets(ctx, req.Storage)
+	if listErr != nil {
+		return cleanErrResp("Unable to list wallets: ", listErr), listErr
+	}
+	for _, username := range usernames {
+		wallet, readErr := b.readWallet(ctx, req.Storage, username)
+		if readErr != nil {
+			return cleanErrResp(fmt.Sprintf("Error reading the wallet of %s: ", username), readErr), readErr
+		}
+		changed, rewrapErr := wallet.rewrap(cfg)
+		if rewrapErr != nil {
+			return cleanErrResp(fmt.Sprintf("Error rewrapping the wallet of %s: ", username), rewrapErr), rewrapErr
+		}
+		if !changed {
+			continue
+		}
+		if storeErr := b.writeWallet(ctx, req.Storage, username, wallet); storeErr != nil {
+			return cleanErrResp(fmt.Sprintf("Error storing the wallet of %s: ", username), storeErr), storeErr
+		}
+		rewrapped++
+	}
+
+	// Named keys are listed as "<username>/" under their prefix
+	userPrefixes, listErr := req.Storage.List(ctx, namedKeysStoragePrefix)
+	if listErr != nil {
+		return cleanErrResp("Unable to list named keys: ", listErr), listErr
+	}
+	for _, userPrefix := range userPrefixes {
+		username := strings.TrimSuffix(userPrefix, "/")
+		names, listErr := b.listNamedKeys(ctx, req.Storage, username)
+		if listErr != nil {
+			return cleanErrResp(fmt.Sprintf("Unable to list the keys of %s: ", username), listErr), listErr
+		}
+		for _, name := range names {
+			key, readErr := b.readNamedKey(ctx, req.Storage, username, name)
+			if readErr != nil {
+				return cleanErrResp(fmt.Sprintf("Error reading key %s of %s: ", name, username), readErr), readErr
+			}
+			changed, rewrapErr := key.rewrap(cfg)
+			if rewrapErr != nil {
+				return cleanErrResp(fmt.Sprintf("Error rewrapping key %s of %s: ", name, username), rewrapErr), rewrapErr
+			}
+			if !changed {
+				continue
+			}
+			if storeErr := b.writeNamedKey(ctx, req.Storage, username, name, key); storeErr != nil {
+				return cleanErrResp(fmt.Sprintf("Error storing key %s of %s: ", name, username), storeErr), storeErr
+			}
+			rewrapped++
+		}
+	}
+
+	// configLock has been held since the config was read, so nothing was sealed under an old version meanwhile
+	if deleteOldVersions {
+		for _, version := range cfg.MasterKeyVersions() {
+			if version < cfg.MasterKeyVersion {
+				delete(cfg.MasterKeys, version)
+			}
+		}
+		if storeErr := b.writeConfig(ctx, req.Storage, cfg); storeErr != nil {
+			return cleanErrResp("Error saving the config StorageEntry: ", storeErr), storeErr
+		}
+	}
+	if _, auditErr := b.recordAuditEvent(ctx, req, &AuditEvent{
+		Operation: "master-key-rewrap",
+		Detail:    fmt.Sprintf("version=%d rewrapped=%d delete_old_versions=%t", cfg.MasterKeyVersion, rewrapped, deleteOldVersions),
+	}); auditErr != nil {
+		return cleanErrResp("Unable to record the rewrap in the audit trail: ", auditErr), auditErr
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"rewrapped":           rewrapped,
+			"master_key_version":  cfg.MasterKeyVersion,
+			"master_key_versions": cfg.MasterKeyVersions(),
+		},
+	}, nil
+}
+
+func (b *backend) pathBackup(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	username := data.Get("username").(string)
+	parts := data.Get("shares").(int)
+	threshold := data.Get("threshold").(int)
+	if threshold < 2 || threshold > parts || parts > 255 {
+		return logical.ErrorResponse("`threshold` must be at least 2 and at most `shares`, which is at most 255."), nil
+	}
+	cfg, loadCfgErr := b.Config(ctx, req.Storage)
+	if loadCfgErr != nil {
+		return readConfigErrResp(loadCfgErr), loadCfgErr
+	}
+
+	usernames := []string{username}
+	if username == "" {
+		var listErr error
+		usernames, listErr = b.listKeyHolders(ctx, req.Storage)
+		if listErr != nil {
+			return cleanErrResp("Unable to list wallets and named keys: ", listErr), listErr
+		}
+	}
+
+	contents := newBackupContents()
+	namedKeyCount := 0
+	for _, username := range usernames {
+		wallet, readErr := b.readWallet(ctx, req.Storage, username)
+		if readErr != nil {
+			return cleanErrResp(fmt.Sprintf("Error reading the wallet of %s: ", username), readErr), readErr
+		}
+		if wallet != nil {
+			plainWallet, unsealErr := wallet.unsealed(cfg)
+			if unsealErr != nil {
+				return cleanErrResp(fmt.Sprintf("Error decrypting the wallet of %s: ", username), unsealErr), unsealErr
+			}
+			contents.Wallets[username] = plainWallet
+		}
+
+		names, listErr := b.listNamedKeys(ctx, req.Storage, username)
+		if listErr != nil {
+			return cleanErrResp(fmt.Sprintf("Unable to list the keys of %s: ", username), listErr), listErr
+		}
+		for _, name := range names {
+			key, readErr := b.readNamedKey(ctx, req.Storage, username, name)
+			if readErr != nil {
+				return cleanErrResp(fmt.Sprintf("Error reading key %s of %s: ", name, username), readErr), readErr
+			}
+			plainKey, unsealErr := key.unsealed(cfg)
+			if unsealErr != nil {
+				return cleanErrResp(fmt.Sprintf("Error decrypting key %s of %s: ", name, username), unsealErr), unsealErr
+			}
+			if contents.NamedKeys[username] == nil {
+				contents.NamedKeys[username] = map[string]*NamedKey{}
+			}
+			contents.NamedKeys[username][name] = plainKey
+			namedKeyCount++
+		}
+	}
+	if len(contents.Wallets) == 0 && namedKeyCount == 0 {
+		return logical.ErrorResponse("No keys were found to back up."), nil
+	}
+
+	bundle, shares, sealErr := sealBackup(contents, parts, threshold)
+	if sealErr != nil {
+		return cleanErrResp("Unable to encrypt the backup: ", sealErr), sealErr
+	}
+	hexShares := make([]string, len(shares))
+	for i, share := range shares {
+		hexShares[i] = hex.EncodeToString(share)
+	}
+
+	auditID, auditErr := b.recordAuditEvent(ctx, req, &AuditEvent{
+		Operation: "backup",
+		Username:  username,
+		Detail:    fmt.Sprintf("wallets=%d named_keys=%d shares=%d threshold=%d", len(contents.Wallets), namedKeyCount, parts, threshold),
+	})
+	if auditErr != nil {
+		return cleanErrResp("Unable to record the backup in the audit trail, not returning it: ", auditErr), auditErr
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"bundle":     bundle,
+			"shares":     hexShares,
+			"threshold":  threshold,
+			"wallets":    len(contents.Wallets),
+			"named_keys": namedKeyCount,
+			"audit_id":   auditID,
+		},
+	}, nil
+}
+
+func (b *backend) pathRestore(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	bundle := data.Get("bundle").(string)
+	hexShares := data.Get("shares").([]string)
+	overwrite := data.Get("overwrite").(bool)
+	if bundle == "" || len(hexShares) == 0 {
+		return logical.ErrorResponse("Must provide the `bundle` and its `shares`."), nil
+	}
+	shares := make([][]byte, len(hexShares))
+	for i, hexShare := range hexShares {
+		share, decodeErr := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(hexShare), "0x"))
+		if decodeErr != nil {
+			return logical.ErrorResponse(fmt.Sprintf("Share %d is not valid hex: %v", i+1, decodeErr)), nil
+		}
+		shares[i] = share
+	}
+	contents, openErr := openBackup(bundle, shares)
+	if openErr != nil {
+		return cleanErrResp("Unable to open the backup: ", openErr), nil
+	}
+
+	b.configLock.RLock()
+	defer b.configLock.RUnlock()
+	cfg, loadCfgErr := b.Config(ctx, req.Storage)
+	if loadCfgErr != nil {
+		return readConfigErrResp(loadCfgErr), loadCfgErr
+	}
+
+	restored := []string{}
+	skipped := []string{}
+	for username, wallet := range contents.Wallets {
+		existing, readErr := b.readWallet(ctx, req.Storage, username)
+		if readErr != nil {
+			return cleanErrResp(fmt.Sprintf("Error checking storage for %s: ", username), readErr), readErr
+		}
+		if existing != nil && !overwrite {
+			skipped = append(skipped, username)
+			continue
+		}
+		if _, sealErr := wallet.rewrap(cfg); sealErr != nil {
+			return cleanErrResp(fmt.Sprintf("Error sealing the wallet of %s: ", username), sealErr), sealErr
+		}
+		if storeErr := b.writeWallet(ctx, req.Storage, username, wallet); storeErr != nil {
+			return cleanErrResp(fmt.Sprintf("Error storing the wallet of %s: ", username), storeErr), storeErr
+		}
+		if indexErr := b.writeWalletOwner(ctx, req.Storage, cfg, username, wallet); indexErr != nil {
+			return cleanErrResp(fmt.Sprintf("Error recording address owner for %s: ", username), indexErr), indexErr
+		}
+		restored = append(restored, username)
+	}
+	for username, keys := range contents.NamedKeys {
+		for name, key := range keys {
+			existing, readErr := b.readNamedKey(ctx, req.Storage, username, name)
+			if readErr != nil {
+				return cleanErrResp(fmt.Sprintf("Error checking storage for key %s of %s: ", name, username), readErr), readErr
+			}
+			if existing != nil && !overwrite {
+				skipped = append(skipped, username+"/"+name)
+				continue
+			}
+			if _, sealErr := key.rewrap(cfg); sealErr != nil {
+				return cleanErrResp(fmt.Sprintf("Error sealing key %s of %s: ", name, username), sealErr), sealErr
+			}
+			if storeErr := b.writeNamedKey(ctx, req.Storage, username, name, key); storeErr != nil {
+				return cleanErrResp(fmt.Sprintf("Error storing key %s of %s: ", name, username), storeErr), storeErr
+			}
+			owner := &addressOwner{Username: username, KeyName: name}
+			for _, pubAddress := range append([]string{key.PublicAddressHex}, archivedAddresses(key.ArchivedVersions)...) {
+				if indexErr := b.writeAddressOwner(ctx, req.Storage, pubAddress, owner); indexErr != nil {
+					return cleanErrResp(fmt.Sprintf("Error recording address owner for key %s of %s: ", name, username), indexErr), indexErr
+				}
+			}
+			restored = append(restored, username+"/"+name)
+		}
+	}
+	sort.Strings(restored)
+	sort.Strings(skipped)
+
+	auditID, auditErr := b.recordAuditEvent(ctx, req, &AuditEvent{
+		Operation: "restore",
+		Detail:    fmt.Sprintf("restored=%d skipped=%d overwrite=%t", len(restored), len(skipped), overwrite),
+	})
+	if auditErr != nil {
+		return cleanErrResp("Unable to record the restore in the audit trail: ", auditErr), auditErr
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"restored": restored,
+			"skipped":  skipped,
+			"audit_id": auditID,
+		},
+	}, nil
+}
+
+func (b *backend) pathNonce(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	client, buildClientErr := ClientFromContext(b, ctx, req)
+	if buildClientErr != nil {
+		return cleanErrResp("Error building client: ", buildClientErr), buildClientErr
+	}
+	username, usernameErr := client.usernameFromTokenAccessor(req.ClientTokenAccessor)
+	if usernameErr != nil {
+		return keyFromTokenErrResp(usernameErr), usernameErr
+	}
+	key, readKeyErr := b.signingKey(ctx, req.Storage, username, data)
+	if readKeyErr != nil {
+		return keyFromTokenErrResp(readKeyErr), readKeyErr
+	}
+	pubAddress, addressErr := key.Address()
+	if addressErr != nil {
+		return cleanErrResp("Error building address from the private key: ", addressErr), addressErr
+	}
+	chain, chainErr := b.resolveChain(ctx, req.Storage, data.Get("chain").(string), data.Get("chain_id").(int))
+	if chainErr != nil {
+		return cleanErrResp(chainErr.Error(), nil), nil
+	}
+	chainID := chain.ChainID
+
+	respData := map[string]interface{}{}
+	var state *nonceState
+	var stateErr error
+	switch data.Get("action").(string) {
+	case "":
+		state, stateErr = b.readNonceState(ctx, req.Storage, chainID, pubAddress)
+		if stateErr != nil {
+			return cleanErrResp("Error reading the nonce: ", stateErr), stateErr
+		}
+	case "reserve":
+		count := data.Get("count").(int)
+		if count < 1 || count > maxBatchSize {
+			return logical.ErrorResponse(fmt.Sprintf("`count` must be between 1 and %d.", maxBatchSize)), nil
+		}
+		reserved := make([]uint64, count)
+		state, stateErr = b.updateNonceState(ctx, req.Storage, chainID, pubAddress, func(state *nonceState) error {
+			if chain.RPCURL != "" && state.fresh() {
+				if err := b.syncNonceState(ctx, chain, pubAddress, state); err != nil {
+					return err
+				}
+			}
+			for i := range reserved {
+				reserved[i] = state.take()
+			}
+			return nil
+		})
+		if stateErr != nil {
+			return cleanErrResp("Unable to reserve nonces: ", stateErr), stateErr
+		}
+		respData["reserved"] = reserved
+	case "release":
+		nonce, hasNonce := data.GetOk("nonce")
+		if !hasNonce || nonce.(int) < 0 {
+			return logical.ErrorResponse("Must provide the `nonce` to release."), nil
+		}
+		var releaseErr error
+		state, stateErr = b.updateNonceState(ctx, req.Storage, chainID, pubAddress, func(state *nonceState) error {
+			releaseErr = state.release(uint64(nonce.(int)))
+			return releaseErr
+		})
+		if releaseErr != nil {
+			return cleanErrResp("Unable to release the nonce: ", releaseErr), nil
+		}
+		if stateErr != nil {
+			return cleanErrResp("Unable to release the nonce: ", stateErr), stateErr
+		}
+	case "sync":
+		var syncErr error
+		state, stateErr = b.updateNonceState(ctx, req.Storage, chainID, pubAddress, func(state *nonceState) error {
+			syncErr = b.syncNonceState(ctx, chain, pubAddress, state)
+			return syncErr
+		})
+		if syncErr != nil {
+			return cleanErrResp("Unable to sync the nonce: ", syncErr), nil
+		}
+		if stateErr != nil {
+			return cleanErrResp("Unable to sync the nonce: ", stateErr), stateErr
+		}
+	}
+
+	freshToken, freshTokenErr := client.makeFreshToken(req.ClientTokenAccessor)
+	if freshTokenErr != nil {
+		return cleanErrResp("Unable to create a fresh_client_token: ", freshTokenErr), freshTokenErr
+	}
+	respData["address"] = pubAddress
+	respData["chain"] = chain.Name
+	respData["chain_id"] = chainID
+	respData["next_nonce"] = state.Next
+	respData["released"] = state.Released
+	respData["synced_at"] = state.SyncedAt
+	respData["fresh_client_token"] = freshToken
+	return &logical.Response{Data: respData}, nil
+}
+
+func (b *backend) pathListChains(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if migrateErr := b.migrateLegacyRPCURLs(ctx, req.Storage); migrateErr != nil {
+		return cleanErrResp("Error migrating the rpc/ urls: ", migrateErr), migrateErr
+	}
+	names, listErr := req.Storage.List(ctx, chainStoragePrefix)
+	if listErr != nil {
+		return cleanErrResp("Error listing chains: ", listErr), listErr
+	}
+	return logical.ListResponse(names), nil
+}
+
+func (b *backend) pathWriteChain(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if migrateErr := b.migrateLegacyRPCURLs(ctx, req.Storage); migrateErr != nil {
+		return cleanErrResp("Error migrating the rpc/ urls: ", migrateErr), migrateErr
+	}
+	name := data.Get("name").(string)
+	profile, readErr := b.readChainProfile(ctx, req.Storage, name)
+	if readErr != nil {
+		return cleanErrResp("Error reading the chain: ", readErr), readErr
+	}
+	// Fields left out keep their current values, so a chain can be disabled without restating it
+	if profile == nil {
+		profile = &ChainProfile{Name: name, Enabled: true}
+	}
+	if chainID, hasChainID := data.GetOk("chain_id"); hasChainID {
+		profile.ChainID = chainID.(int)
+	}
+	if profile.ChainID <= 0 || profile.ChainID > maxChainID {
+		return logical.ErrorResponse("`chain_id` must be a positive integer."), nil
+	}
+	if rpcURL, hasRPCURL := data.GetOk("rpc_url"); hasRPCURL {
+		url := rpcURL.(string)
+		if url != "" && !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return logical.ErrorResponse("`rpc_url` must be an http:// or https:// JSON-RPC endpoint."), nil
+		}
+		profile.RPCURL = url
+	}
+	if gasLimit, hasGasLimit := data.GetOk("default_gas_limit"); hasGasLimit {
+		if gasLimit.(int) < 0 {
+			return logical.ErrorResponse("`default_gas_limit` cannot be negative."), nil
+		}
+		profile.DefaultGasLimit = uint64(gasLimit.(int))
+	}
+	if maxGasPrice, hasMaxGasPrice := data.GetOk("max_gas_price"); hasMaxGasPrice {
+		profile.MaxGasPrice = nil
+		if maxGasPrice.(string) != "" {
+			parsed, parseErr := parseWei(maxGasPrice.(string))
+			if parseErr != nil {
+				return cleanErrResp("Invalid `max_gas_price`: ", parseErr), nil
+			}
+			profile.MaxGasPrice = parsed
+		}
+	}
+	if enabled, hasEnabled := data.GetOk("enabled"); hasEnabled {
+		profile.Enabled = enabled.(bool)
+	}
+
+	// Chains are also looked up by ID, so no two may share one
+	existing, lookupErr := b.chainProfileByID(ctx, req.Storage, profile.ChainID)
+	if lookupErr != nil {
+		return cleanErrResp("Error reading the chains: ", lookupErr), lookupErr
+	}
+	if existing != nil && existing.Name != name {
+		return logical.ErrorResponse(fmt.Sprintf("Chain ID %d is already registered as %s.", profile.ChainID, existing.Name)), nil
+	}
+	if writeErr := b.writeChainProfile(ctx, req.Storage, profile); writeErr != nil {
+		return cleanErrResp("Error saving the chain: ", writeErr), writeErr
+	}
+	return &logical.Response{Data: chainProfileData(profile)}, nil
+}
+
+func (b *backend) pathReadChain(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if migrateErr := b.migrateLegacyRPCURLs(ctx, req.Storage); migrateErr != nil {
+		return cleanErrResp("Error migrating the rpc/ urls: ", migrateErr), migrateErr
+	}
+	profile, readErr := b.readChainProfile(ctx, req.Storage, data.Get("name").(string))
+	if readErr != nil {
+		return cleanErrResp("Error reading the chain: ", readErr), readErr
+	}
+	if profile == nil {
+		return nil, nil
+	}
+	return &logical.Response{Data: chainProfileData(profile)}, nil
+}
+
+func (b *backend) pathDeleteChain(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if migrateErr := b.migrateLegacyRPCURLs(ctx, req.Storage); migrateErr != nil {
+		return cleanErrResp("Error migrating the rpc/ urls: ", migrateErr), migrateErr
+	}
+	if deleteErr := req.Storage.Delete(ctx, chainStoragePrefix+data.Get("name").(string)); deleteErr != nil {
+		return cleanErrResp("Error deleting the chain: ", deleteErr), deleteErr
+	}
+	return nil, nil
+}
+
+func chainProfileData(profile *ChainProfile) map[string]interface{} {
+	respData := map[string]interface{}{
+		"name":              profile.Name,
+		"chain_id":          profile.ChainID,
+		"rpc_url":           profile.RPCURL,
+		"default_gas_limit": profile.DefaultGasLimit,
+		"max_gas_price_wei": nil,
+		"enabled":           profile.Enabled,
+	}
+	if profile.MaxGasPrice != nil {
+		respData["max_gas_price_wei"] = profile.MaxGasPrice.String()
+	}
+	return respData
+}
+
+// spendingLimitPath : Where the limit for the user or group named in the request is stored
+func spendingLimitPath(data *framework.FieldData) string {
+	if data.Get("kind").(string) == "groups" {
+		return groupLimitStoragePrefix + data.Get("name").(string)
+	}
+	return userLimitStoragePrefix + data.Get("name").(string)
+}
+
+func (b *backend) pathListSpendingLimits(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	prefix := userLimitStoragePrefix
+	if data.Get("kind").(string) == "groups" {
+		prefix = groupLimitStoragePrefix
+	}
+	names, listErr := req.Storage.List(ctx, prefix)
+	if listErr != nil {
+		return cleanErrResp("Error listing spending limits: ", listErr), listErr
+	}
+	return logical.ListResponse(names), nil
+}
+
+func (b *backend) pathWriteSpendingLimit(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := spendingLimitPath(data)
+	limit, readErr := b.readSpendingLimit(ctx, req.Storage, path)
+	if readErr != nil {
+		return cleanErrResp("Error reading the spending limit: ", readErr), readErr
+	}
+	// Caps left out keep their current values
+	if limit == nil {
+		limit = &SpendingLimit{}
+	}
+	for field, limitCap := range map[string]**big.Int{"per_tx": &limit.PerTx, "daily": &limit.Daily, "monthly": &limit.Monthly} {
+		value, hasValue := data.GetOk(field)
+		if !hasValue {
+			continue
+		}
+		*limitCap = nil
+		if value.(string) != "" {
+			parsed, parseErr := parseWei(value.(string))
+			if parseErr != nil {
+				return cleanErrResp(fmt.Sprintf("Invalid `%s`: ", field), parseErr), nil
+			}
+			*limitCap = parsed
+		}
+	}
+	if writeErr := b.writeSpendingLimit(ctx, req.Storage, path, limit); writeErr != nil {
+		return cleanErrResp("Error saving the spending limit: ", writeErr), writeErr
+	}
+	return &logical.Response{Data: spendingLimitData(limit)}, nil
+}
+
+func (b *backend) pathReadSpendingLimit(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	limit, readErr := b.readSpendingLimit(ctx, req.Storage, spendingLimitPath(data))
+	if readErr != nil {
+		return cleanErrResp("Error reading the spending limit: ", readErr), readErr
+	}
+	if limit == nil {
+		return nil, nil
+	}
+	return &logical.Response{Data: spendingLimitData(limit)}, nil
+}
+
+func (b *backend) pathDeleteSpendingLimit(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if deleteErr := req.Storage.Delete(ctx, spendingLimitPath(data)); deleteErr != nil {
+		return cleanErrResp("Error deleting the spending limit: ", deleteErr), deleteErr
+	}
+	return nil, nil
+}
+
+func spendingLimitData(limit *SpendingLimit) map[string]interface{} {
+	respData := map[string]interface{}{}
+	for field, limitCap := range map[string]*big.Int{"per_tx_wei": limit.PerTx, "daily_wei": limit.Daily, "monthly_wei": limit.Monthly} {
+		respData[field] = nil
+		if limitCap != nil {
+			respData[field] = limitCap.String()
+		}
+	}
+	return respData
+}
+
+func (b *backend) pathListAddressLists(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	names, listErr := req.Storage.List(ctx, addressListStoragePrefix+data.Get("kind").(string)+"/")
+	if listErr != nil {
+		return cleanErrResp("Error listing address lists: ", listErr), listErr
+	}
+	return logical.ListResponse(names), nil
+}
+
+func (b *backend) pathWriteAddressList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	scope := data.Get("scope").(string)
+	list, readErr := b.readAddressList(ctx, req.Storage, scope)
+	if readErr != nil {
+		return cleanErrResp("Error reading the address list: ", readErr), readErr
+	}
+	// Fields left out keep their current values
+	if list == nil {
+		list = &AddressList{Addresses: map[string]string{}}
+	}
+	if mode, hasMode := data.GetOk("mode"); hasMode {
+		list.Mode = mode.(string)
+	}
+	if !validAddressListMode(list.Mode) {
+		return logical.ErrorResponse("`mode` must be allowlist, denylist or value_allowlist."), nil
+	}
+	if addressesJSON, hasAddresses := data.GetOk("addresses"); hasAddresses {
+		var labels map[string]string
+		if decodeErr := json.Unmarshal([]byte(addressesJSON.(string)), &labels); decodeErr != nil {
+			return cleanErrResp("`addresses` must be a JSON object of addresses to labels: ", decodeErr), nil
+		}
+		list.Addresses = map[string]string{}
+		for address, label := range labels {
+			if !common.IsHexAddress(address) {
+				return logical.ErrorResponse(fmt.Sprintf("%s is not a valid address.", address)), nil
+			}
+			list.Addresses[strings.ToLower(common.HexToAddress(address).Hex())] = label
+		}
+	}
+	if writeErr := b.writeAddressList(ctx, req.Storage, scope, list); writeErr != nil {
+		return cleanErrResp("Error saving the address list: ", writeErr), writeErr
+	}
+	return &logical.Response{Data: addressListData(list)}, nil
+}
+
+func (b *backend) pathReadAddressList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	list, readErr := b.readAddressList(ctx, req.Storage, data.Get("scope").(string))
+	if readErr != nil {
+		return cleanErrResp("Error reading the address list: ", readErr), readErr
+	}
+	if list == nil {
+		return nil, nil
+	}
+	return &logical.Response{Data: addressListData(list)}, nil
+}
+
+func (b *backend) pathDeleteAddressList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if deleteErr := req.Storage.Delete(ctx, addressListStoragePrefix+data.Get("scope").(string)); deleteErr != nil {
+		return cleanErrResp("Error deleting the address list: ", deleteErr), deleteErr
+	}
+	return nil, nil
+}
+
+func (b *backend) pathWriteListedAddress(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	scope := data.Get("scope").(string)
+	list, readErr := b.readAddressList(ctx, req.Storage, scope)
+	if readErr != nil {
+		return cleanErrResp("Error reading the address list: ", readErr), readErr
+	}
+	if list == nil {
+		return logical.ErrorResponse(fmt.Sprintf("There is no %s address list, write its mode first.", scope)), nil
+	}
+	list.Addresses[strings.ToLower(data.Get("address").(string))] = data.Get("label").(string)
+	if writeErr := b.writeAddressList(ctx, req.Storage, scope, list); writeErr != nil {
+		return cleanErrResp("Error saving the address list: ", writeErr), writeErr
+	}
+	return &logical.Response{Data: addressListData(list)}, nil
+}
+
+func (b *backend) pathDeleteListedAddress(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	scope := data.Get("scope").(string)
+	list, readErr := b.readAddressList(ctx, req.Storage, scope)
+	if readErr != nil {
+		return cleanErrResp("Error reading the address list: ", readErr), readErr
+	}
+	if list == nil {
+		return nil, nil
+	}
+	delete(list.Addresses, strings.ToLower(data.Get("address").(string)))
+	if writeErr := b.writeAddressList(ctx, req.Storage, scope, list); writeErr != nil {
+		return cleanErrResp("Error saving the address list: ", writeErr), writeErr
+	}
+	return nil, nil
+}
+
+func addressListData(list *AddressList) map[string]interface{} {
+	return map[string]interface{}{
+		"mode":      list.Mode,
+		"addresses": list.Addresses,
+	}
+}
+
+func (b *backend) pathListCallPolicies(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	contracts, listErr := req.Storage.List(ctx, callPolicyStoragePrefix)
+	if listErr != nil {
+		return cleanErrResp("Error listing call policies: ", listErr), listErr
+	}
+	return logical.ListResponse(contracts), nil
+}
+
+func (b *backend) pathWriteCallPolicy(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	contract := data.Get("contract").(string)
+	policy, readErr := b.readCallPolicy(ctx, req.Storage, contract)
+	if readErr != nil {
+		return cleanErrResp("Error reading the call policy: ", readErr), readErr
+	}
+	// Fields left out keep their current values
+	if policy == nil {
+		policy = &CallPolicy{Rules: map[string]*CallRule{}}
+	}
+	if mode, hasMode := data.GetOk("mode"); hasMode {
+		policy.Mode = mode.(string)
+	}
+	if policy.Mode != allowlistMode && policy.Mode != denylistMode {
+		return logical.ErrorResponse("`mode` must be allowlist or denylist."), nil
+	}
+	if rulesJSON, hasRules := data.GetOk("rules"); hasRules {
+		rules, parseErr := b.parseCallRules(ctx, req.Storage, rulesJSON.(string))
+		if parseErr != nil {
+			return cleanErrResp("Invalid `rules`: ", parseErr), nil
+		}
+		policy.Rules = rules
+	}
+	if policy.Mode == denylistMode {
+		for selector, rule := range policy.Rules {
+			if len(rule.Constraints) > 0 {
+				return logical.ErrorResponse(fmt.Sprintf("Denylists refuse their methods outright, %s cannot have constraints.", selector)), nil
+			}
+		}
+	}
+	if writeErr := b.writeCallPolicy(ctx, req.Storage, contract, policy); writeErr != nil {
+		return cleanErrResp("Error saving the call policy: ", writeErr), writeErr
+	}
+	return &logical.Response{Data: callPolicyData(policy)}, nil
+}
+
+func (b *backend) pathReadCallPolicy(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	policy, readErr := b.readCallPolicy(ctx, req.Storage, data.Get("contract").(string))
+	if readErr != nil {
+		return cleanErrResp("Error reading the call policy: ", readErr), readErr
+	}
+	if policy == nil {
+		return nil, nil
+	}
+	return &logical.Response{Data: callPolicyData(policy)}, nil
+}
+
+func (b *backend) pathDeleteCallPolicy(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if deleteErr := req.Storage.Delete(ctx, callPolicyStoragePrefix+strings.ToLower(data.Get("contract").(string))); deleteErr != nil {
+		return cleanErrResp("Error deleting the call policy: ", deleteErr), deleteErr
+	}
+	return nil, nil
+}
+
+// callPolicyData : The policy's rules keyed by selector, with constraint caps as decimal strings
+func callPolicyData(policy *CallPolicy) map[string]interface{} {
+	rules := map[string]interface{}{}
+	for selector, rule := range policy.Rules {
+		constraints := []map[string]interface{}{}
+		for _, constraint := range rule.Constraints {
+			constraintData := map[string]interface{}{"arg": constraint.Arg}
+			if constraint.OneOf != nil {
+				constraintData["one_of"] = constraint.OneOf
+			}
+			if constraint.Max != nil {
+				constraintData["max"] = constraint.Max.String()
+			}
+			constraints = append(constraints, constraintData)
+		}
+		rules[selector] = map[string]interface{}{
+			"signature":   rule.Signature,
+			"abi_name":    rule.ABIName,
+			"constraints": constraints,
+		}
+	}
+	return map[string]interface{}{
+		"mode":  policy.Mode,
+		"rules": rules,
+	}
+}
@@ -0,0 +1,176 @@
+package guardian
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// policyUser : The user policies are checked for.  Their Okta groups are only looked up once,
+// and only if some policy is set for a group.
+type policyUser struct {
+	client   *Client
+	username string
+	groups   []string
+	fetched  bool
+}
+
+func newPolicyUser(client *Client, username string) *policyUser {
+	return &policyUser{client: client, username: username}
+}
+
+func (user *policyUser) oktaGroups() ([]string, error) {
+	if !user.fetched {
+		groups, err := user.client.oktaGroupNames(user.username)
+		if err != nil {
+			return nil, fmt.Errorf("unable to look up the user's Okta groups: %v", err)
+		}
+		user.groups, user.fetched = groups, true
+	}
+	return user.groups, nil
+}
+
+// groupsWithPolicy : Which of the user's Okta groups have a policy stored under the prefix
+func (b *backend) groupsWithPolicy(ctx context.Context, s logical.Storage, user *policyUser, prefix string) ([]string, error) {
+	stored, err := s.List(ctx, prefix)
+	if err != nil || len(stored) == 0 {
+		return nil, err
+	}
+	groups, err := user.oktaGroups()
+	if err != nil {
+		return nil, err
+	}
+	withPolicy := []string{}
+	for _, group := range groups {
+		for _, name := range stored {
+			if name == group {
+				withPolicy = append(withPolicy, group)
+				break
+			}
+		}
+	}
+	return withPolicy, nil
+}
+
+// txPolicyViolations : Describes each policy the transactions would break if the user signed them
+func (b *backend) txPolicyViolations(ctx context.Context, s logical.Storage, user *policyUser, txs []*txArgs) ([]string, error) {
+	violations, err := b.recipientViolations(ctx, s, user, txs)
+	if err != nil {
+		return nil, err
+	}
+	callViolations, err := b.callViolations(ctx, s, txs)
+	if err != nil {
+		return nil, err
+	}
+	violations = append(violations, callViolations...)
+	spendingViolations, err := b.spendingViolations(ctx, s, user, txs)
+	if err != nil {
+		return nil, err
+	}
+	return append(violations, spendingViolations...), nil
+}
+
+// rawSigningViolations : A raw hash could be the signing hash of any transaction, which no policy can see
+// into, so users covered by a spending limit or address list may not sign one.  Call policies cover every
+// user, so they are only enforced against raw hashes once an admin sets refuse_raw_signing.
+func (b *backend) rawSigningViolations(ctx context.Context, s logical.Storage, user *policyUser) ([]string, error) {
+	cfg, err := b.Config(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	violations := []string{}
+	if cfg.RefuseRawSigning {
+		violations = append(violations, "raw hash signing is turned off, so call policies cannot be bypassed")
+	}
+	limit, err := b.userSpendingLimit(ctx, s, user)
+	if err != nil {
+		return nil, err
+	}
+	if limit != nil {
+		violations = append(violations, "raw hashes cannot be signed under a spending limit")
+	}
+	scopes, err := b.addressListScopes(ctx, s, user)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range scopes {
+		list, err := b.readAddressList(ctx, s, scope)
+		if err != nil {
+			return nil, err
+		}
+		if list != nil {
+			violations = append(violations, fmt.Sprintf("raw hashes cannot be signed under the %s address list", describeScope(scope)))
+			break
+		}
+	}
+	return violations, nil
+}
+
+// policyErrResp : Refuses a signature for breaking policy, saying which and why
+func policyErrResp(violations []string) *logical.Response {
+	return logical.ErrorResponse("Refused by policy, nothing was signed: " + strings.Join(violations, "; ") + ".")
+}
+
+// reservePolicy : Checks the transactions against every policy, recording what they spend if they pass.
+// The returned release forgets the spending again, for when the transactions could not be signed.
+func (b *backend) reservePolicy(ctx context.Context, s logical.Storage, user *policyUser, txs []*txArgs) (release func() error, violations []string, err error) {
+	violations, err = b.recipientViolations(ctx, s, user, txs)
+	if err != nil {
+		return nil, nil, err
+	}
+	callViolations, err := b.callViolations(ctx, s, txs)
+	if err != nil {
+		return nil, nil, err
+	}
+	violations = append(violations, callViolations...)
+	if len(violations) > 0 {
+		return nil, violations, nil
+	}
+	return b.reserveSpending(ctx, s, user, txs)
+}
+
+// signTxWithinPolicy : Signs the transaction as signTx does, so long as every policy allows it
+func (b *backend) signTxWithinPolicy(ctx context.Context, s logical.Storage, user *policyUser, key *SigningKey, args *txArgs) (jsonTx, rlpTx string, violations []string, err error) {
+	release, violations, err := b.reservePolicy(ctx, s, user, []*txArgs{args})
+	if err != nil || len(violations) > 0 {
+		return "", "", violations, err
+	}
+	jsonTx, rlpTx, err = b.signTx(ctx, s, key, args)
+	if err != nil {
+		if releaseErr := release(); releaseErr != nil {
+			return "", "", nil, fmt.Errorf("%v, and the spending could not be released: %v", err, releaseErr)
+		}
+		return "", "", nil, err
+	}
+	return jsonTx, rlpTx, nil, nil
+}
+
+// signBatchWithinPolicy : Signs the batch as signBatch does, so long as every policy allows all of its transactions
+func (b *backend) signBatchWithinPolicy(ctx context.Context, s logical.Storage, user *policyUser, key *SigningKey, items []batchItem) (results []map[string]interface{}, violations []string, err error) {
+	txs := []*txArgs{}
+	for _, item := range items {
+		if item.Tx != nil {
+			txs = append(txs, item.Tx)
+		}
+	}
+	if len(txs) < len(items) {
+		violations, err = b.rawSigningViolations(ctx, s, user)
+		if err != nil || len(violations) > 0 {
+			return nil, violations, err
+		}
+	}
+	release, violations, err := b.reservePolicy(ctx, s, user, txs)
+	if err != nil || len(violations) > 0 {
+		return nil, violations, err
+	}
+	results, err = b.signBatch(ctx, s, key, items)
+	if err != nil {
+		if releaseErr := release(); releaseErr != nil {
+			return nil, nil, fmt.Errorf("%v, and the spending could not be released: %v", err, releaseErr)
+		}
+		return nil, nil, err
+	}
+	return results, nil, nil
+}
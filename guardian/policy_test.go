@@ -0,0 +1,54 @@
+package guardian
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestRawSigningViolations(t *testing.T) {
+	ctx := context.Background()
+	b := Backend(&logical.BackendConfig{})
+	s, cfg := testStorage(t, b)
+	alice := &policyUser{username: "alice", fetched: true}
+	bob := &policyUser{username: "bob", fetched: true}
+
+	if violations, err := b.rawSigningViolations(ctx, s, alice); err != nil || len(violations) != 0 {
+		t.Fatalf("refused without any policy: %v %v", violations, err)
+	}
+
+	if err := b.writeSpendingLimit(ctx, s, userLimitStoragePrefix+"alice", &SpendingLimit{Daily: big.NewInt(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if violations, err := b.rawSigningViolations(ctx, s, alice); err != nil || len(violations) != 1 {
+		t.Errorf("allowed under a spending limit: %v %v", violations, err)
+	}
+	if violations, err := b.rawSigningViolations(ctx, s, bob); err != nil || len(violations) != 0 {
+		t.Errorf("refused for another user's limit: %v %v", violations, err)
+	}
+
+	if err := b.writeAddressList(ctx, s, userAddressListScope+"bob", &AddressList{Mode: denylistMode, Addresses: map[string]string{}}); err != nil {
+		t.Fatal(err)
+	}
+	if violations, err := b.rawSigningViolations(ctx, s, bob); err != nil || len(violations) != 1 {
+		t.Errorf("allowed under an address list: %v %v", violations, err)
+	}
+
+	// Call policies alone refuse nothing until raw signing is turned off
+	carol := &policyUser{username: "carol", fetched: true}
+	if err := b.writeCallPolicy(ctx, s, anyContractScope, &CallPolicy{Mode: denylistMode}); err != nil {
+		t.Fatal(err)
+	}
+	if violations, err := b.rawSigningViolations(ctx, s, carol); err != nil || len(violations) != 0 {
+		t.Errorf("refused for a call policy alone: %v %v", violations, err)
+	}
+	cfg.RefuseRawSigning = true
+	if err := b.writeConfig(ctx, s, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if violations, err := b.rawSigningViolations(ctx, s, carol); err != nil || len(violations) != 1 {
+		t.Errorf("allowed with refuse_raw_signing set: %v %v", violations, err)
+	}
+}
@@ -0,0 +1,52 @@
+package guardian
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/eximchain/go-ethereum/core/types"
+)
+
+// privatePayloadHashSize : Length of the hash the transaction manager returns for a stored private payload
+const privatePayloadHashSize = 64
+
+// quorumPrivateSigner : Quorum's signer for private transactions.  They are signed over the Homestead hash,
+// without a chain ID, and marked private by a v of 37 or 38 rather than 27 or 28.
+type quorumPrivateSigner struct{ types.HomesteadSigner }
+
+func (s quorumPrivateSigner) Equal(s2 types.Signer) bool {
+	_, ok := s2.(quorumPrivateSigner)
+	return ok
+}
+
+// SignatureValues : The Homestead values, with v moved up by 10 to mark the transaction private
+func (s quorumPrivateSigner) SignatureValues(tx *types.Transaction, sig []byte) (r, sv, v *big.Int, err error) {
+	r, sv, v, err = s.HomesteadSigner.SignatureValues(tx, sig)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return r, sv, v.Add(v, big.NewInt(10)), nil
+}
+
+// parsePrivatePayloadHash : The transaction manager hands out payload hashes as base64, 0x prefixed hex is accepted too
+func parsePrivatePayloadHash(payloadHash string) ([]byte, error) {
+	var decoded []byte
+	var err error
+	if strings.HasPrefix(payloadHash, "0x") {
+		decoded, err = hex.DecodeString(payloadHash[2:])
+	} else {
+		decoded, err = base64.StdEncoding.DecodeString(payloadHash)
+	}
+	if err != nil || len(decoded) != privatePayloadHashSize {
+		return nil, errors.New("`private_payload_hash` must be the 64 byte hash from the transaction manager, in base64 or 0x prefixed hex.")
+	}
+	return decoded, nil
+}
+
+// signPrivateTxWithHexKey : Signs the args as a Quorum private transaction, whose data is the payload hash
+func signPrivateTxWithHexKey(args *txArgs, privKeyHex string) (jsonTx, rlpTx string, err error) {
+	return signLegacyTxWithHexKey(quorumPrivateSigner{}, privKeyHex, args.Data, args.To, args.Nonce, args.GasLimit, args.Amount, args.GasPrice)
+}
@@ -0,0 +1,87 @@
+package guardian
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/eximchain/go-ethereum/common"
+	"github.com/eximchain/go-ethereum/core/types"
+	"github.com/eximchain/go-ethereum/crypto"
+	"github.com/eximchain/go-ethereum/rlp"
+)
+
+func TestSignPrivateTx(t *testing.T) {
+	privKeyHex := "b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291"
+	privKey, err := crypto.HexToECDSA(privKeyHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PubkeyToAddress(privKey.PublicKey)
+	to := common.HexToAddress("0x095e7baea6a6c7c4c2dfeb977efac326af552d87")
+
+	payloadHash := bytes.Repeat([]byte{0xab, 0xcd, 0xef, 0x01}, privatePayloadHashSize/4)
+	for _, encoded := range []string{
+		base64.StdEncoding.EncodeToString(payloadHash),
+		"0x" + hex.EncodeToString(payloadHash),
+	} {
+		decoded, err := parsePrivatePayloadHash(encoded)
+		if err != nil {
+			t.Fatalf("%s: %v", encoded, err)
+		}
+		if !bytes.Equal(decoded, payloadHash) {
+			t.Errorf("%s parsed to %x", encoded, decoded)
+		}
+	}
+	for _, bad := range []string{
+		"",
+		base64.StdEncoding.EncodeToString(payloadHash[:32]),
+		"0x" + hex.EncodeToString(payloadHash[:63]),
+		hex.EncodeToString(payloadHash),
+	} {
+		if _, err := parsePrivatePayloadHash(bad); err == nil {
+			t.Errorf("accepted payload hash %q", bad)
+		}
+	}
+
+	for nonce := uint64(0); nonce < 4; nonce++ {
+		args := &txArgs{Private: true, ChainID: 1, Nonce: nonce, GasLimit: 4700000, To: &to,
+			Amount: big.NewInt(0), GasPrice: big.NewInt(0), Data: hex.EncodeToString(payloadHash)}
+		_, rlpTx, err := args.signWithHexKey(privKeyHex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rawTx, err := hex.DecodeString(strings.TrimPrefix(rlpTx, "0x"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx := new(types.Transaction)
+		if err := rlp.DecodeBytes(rawTx, tx); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(tx.Data(), payloadHash) {
+			t.Errorf("nonce %d: data is %x, want the payload hash", nonce, tx.Data())
+		}
+		v, r, s := tx.RawSignatureValues()
+		if v.Uint64() != 37 && v.Uint64() != 38 {
+			t.Fatalf("nonce %d: v is %s, want 37 or 38", nonce, v)
+		}
+
+		// Private transactions are signed over the Homestead hash, with the recovery id below the 37
+		sig := make([]byte, 65)
+		copy(sig[32-len(r.Bytes()):32], r.Bytes())
+		copy(sig[64-len(s.Bytes()):64], s.Bytes())
+		sig[64] = byte(v.Uint64() - 37)
+		pub, err := crypto.SigToPub(types.HomesteadSigner{}.Hash(tx).Bytes(), sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := crypto.PubkeyToAddress(*pub); got != from {
+			t.Errorf("nonce %d: recovered %s, want %s", nonce, got.Hex(), from.Hex())
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package guardian
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/eximchain/go-ethereum/common"
+	"github.com/eximchain/go-ethereum/common/hexutil"
+	"github.com/eximchain/go-ethereum/rlp"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// maxChainID : Largest chain ID accepted from an encoded transaction, so it fits txArgs.ChainID on any platform
+const maxChainID = int(^uint32(0) >> 1)
+
+// unsignedLegacyTx : The RLP fields of a legacy transaction, Tail holds the EIP-155 chain ID, 0, 0 if present
+type unsignedLegacyTx struct {
+	Nonce    uint64
+	GasPrice *big.Int
+	GasLimit uint64
+	To       []byte
+	Value    *big.Int
+	Data     []byte
+	Tail     []*big.Int `rlp:"tail"`
+}
+
+// unsignedAccessListTx : The RLP fields of an EIP-2930 transaction, Tail must be empty as it would hold a signature
+type unsignedAccessListTx struct {
+	ChainID    *big.Int
+	Nonce      uint64
+	GasPrice   *big.Int
+	GasLimit   uint64
+	To         []byte
+	Value      *big.Int
+	Data       []byte
+	AccessList []AccessTuple
+	Tail       []rlp.RawValue `rlp:"tail"`
+}
+
+// unsignedDynamicFeeTx : The RLP fields of an EIP-1559 transaction, Tail must be empty as it would hold a signature
+type unsignedDynamicFeeTx struct {
+	ChainID              *big.Int
+	Nonce                uint64
+	MaxPriorityFeePerGas *big.Int
+	MaxFeePerGas         *big.Int
+	GasLimit             uint64
+	To                   []byte
+	Value                *big.Int
+	Data                 []byte
+	AccessList           []AccessTuple
+	Tail                 []rlp.RawValue `rlp:"tail"`
+}
+
+// unsignedTxJSON : geth's transaction JSON, whose signature fields must be absent or zero.  The vendored
+// types.Transaction.UnmarshalJSON insists on a valid signature, so the format is decoded here instead.
+type unsignedTxJSON struct {
+	Type                 *hexutil.Uint64 `json:"type"`
+	ChainID              *hexutil.Big    `json:"chainId"`
+	Nonce                *hexutil.Uint64 `json:"nonce"`
+	GasPrice             *hexutil.Big    `json:"gasPrice"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas"`
+	Gas                  *hexutil.Uint64 `json:"gas"`
+	To                   *common.Address `json:"to"`
+	Value                *hexutil.Big    `json:"value"`
+	Input                *hexutil.Bytes  `json:"input"`
+	AccessList           []AccessTuple   `json:"accessList"`
+	V                    *hexutil.Big    `json:"v"`
+	R                    *hexutil.Big    `json:"r"`
+	S                    *hexutil.Big    `json:"s"`
+}
+
+// rawTxArgsFromData : Decodes the unsigned transaction in `tx_rlp` or `tx_json`, taking its chain ID from the
+// encoding if it has one, which `chain_id` must then match
+func rawTxArgsFromData(data *framework.FieldData) (*txArgs, error) {
+	txRLP, hasRLP := data.GetOk("tx_rlp")
+	txJSON, hasJSON := data.GetOk("tx_json")
+	if hasRLP == hasJSON {
+		return nil, errors.New("Provide exactly one of `tx_rlp` or `tx_json`.")
+	}
+
+	var args *txArgs
+	var encodedChainID *big.Int
+	var err error
+	if hasRLP {
+		args, encodedChainID, err = decodeUnsignedTxRLP(txRLP.(string))
+	} else {
+		args, encodedChainID, err = decodeUnsignedTxJSON(txJSON.(string))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	args.ChainName = data.Get("chain").(string)
+	chainID, hasChainID := data.GetOk("chain_id")
+	switch {
+	case encodedChainID != nil && encodedChainID.Sign() > 0:
+		if !encodedChainID.IsInt64() || encodedChainID.Int64() > int64(maxChainID) {
+			return nil, fmt.Errorf("The transaction's chain ID %s is too large.", encodedChainID)
+		}
+		if hasChainID && int64(chainID.(int)) != encodedChainID.Int64() {
+			return nil, fmt.Errorf("The transaction is for chain ID %s, not `chain_id` %d.", encodedChainID, chainID.(int))
+		}
+		args.ChainID = int(encodedChainID.Int64())
+	case hasChainID && chainID.(int) > 0:
+		args.ChainID = chainID.(int)
+	case hasChainID:
+		return nil, errors.New("`chain_id` must be a positive integer.")
+	}
+
+	for name, value := range map[string]*big.Int{"value": args.Amount, "gas price": args.GasPrice, "max fee per gas": args.MaxFeePerGas, "max priority fee per gas": args.MaxPriorityFeePerGas} {
+		if value != nil && (value.Sign() < 0 || value.BitLen() > 256) {
+			return nil, fmt.Errorf("The transaction's %s is out of range.", name)
+		}
+	}
+	if err := args.validateTxType(); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+func decodeUnsignedTxRLP(txRLP string) (args *txArgs, chainID *big.Int, err error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(txRLP, "0x"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("`tx_rlp` is not valid hex: %v", err)
+	}
+	if len(raw) == 0 {
+		return nil, nil, errors.New("`tx_rlp` is empty.")
+	}
+
+	switch raw[0] {
+	case accessListTxType:
+		var tx unsignedAccessListTx
+		if err := rlp.DecodeBytes(raw[1:], &tx); err != nil {
+			return nil, nil, fmt.Errorf("`tx_rlp` is not an EIP-2930 transaction: %v", err)
+		}
+		if len(tx.Tail) != 0 {
+			return nil, nil, errors.New("`tx_rlp` must be unsigned, with 8 fields.")
+		}
+		args = &txArgs{TxType: accessListTxType, Nonce: tx.Nonce, GasPrice: tx.GasPrice, GasLimit: tx.GasLimit, Amount: tx.Value, Data: hex.EncodeToString(tx.Data), AccessList: tx.AccessList}
+		args.To, err = rawTxRecipient(tx.To)
+		return args, tx.ChainID, err
+
+	case dynamicFeeTxType:
+		var tx unsignedDynamicFeeTx
+		if err := rlp.DecodeBytes(raw[1:], &tx); err != nil {
+			return nil, nil, fmt.Errorf("`tx_rlp` is not an EIP-1559 transaction: %v", err)
+		}
+		if len(tx.Tail) != 0 {
+			return nil, nil, errors.New("`tx_rlp` must be unsigned, with 9 fields.")
+		}
+		args = &txArgs{TxType: dynamicFeeTxType, Nonce: tx.Nonce, MaxPriorityFeePerGas: tx.MaxPriorityFeePerGas, MaxFeePerGas: tx.MaxFeePerGas, GasLimit: tx.GasLimit, Amount: tx.Value, Data: hex.EncodeToString(tx.Data), AccessList: tx.AccessList}
+		args.To, err = rawTxRecipient(tx.To)
+		return args, tx.ChainID, err
+	}
+
+	if raw[0] < 0xc0 {
+		return nil, nil, fmt.Errorf("`tx_rlp` has the unsupported transaction type %d.", raw[0])
+	}
+	var tx unsignedLegacyTx
+	if err := rlp.DecodeBytes(raw, &tx); err != nil {
+		return nil, nil, fmt.Errorf("`tx_rlp` is not a legacy transaction: %v", err)
+	}
+	switch len(tx.Tail) {
+	case 0:
+	case 3:
+		if tx.Tail[1].Sign() != 0 || tx.Tail[2].Sign() != 0 {
+			return nil, nil, errors.New("`tx_rlp` is already signed.")
+		}
+		chainID = tx.Tail[0]
+	default:
+		return nil, nil, errors.New("`tx_rlp` must be a list of 6 fields, or 9 with the EIP-155 chain ID, 0, 0.")
+	}
+	args = &txArgs{Nonce: tx.Nonce, GasPrice: tx.GasPrice, GasLimit: tx.GasLimit, Amount: tx.Value, Data: hex.EncodeToString(tx.Data)}
+	args.To, err = rawTxRecipient(tx.To)
+	return args, chainID, err
+}
+
+func decodeUnsignedTxJSON(txJSON string) (args *txArgs, chainID *big.Int, err error) {
+	var tx unsignedTxJSON
+	if err := json.Unmarshal([]byte(txJSON), &tx); err != nil {
+		return nil, nil, fmt.Errorf("`tx_json` is not valid: %v", err)
+	}
+	for _, sigValue := range []*hexutil.Big{tx.V, tx.R, tx.S} {
+		if sigValue != nil && sigValue.ToInt().Sign() != 0 {
+			return nil, nil, errors.New("`tx_json` is already signed.")
+		}
+	}
+	if tx.Nonce == nil || tx.Gas == nil {
+		return nil, nil, errors.New("`tx_json` requires at least `nonce` and `gas`.")
+	}
+
+	args = &txArgs{
+		To:                   tx.To,
+		Nonce:                uint64(*tx.Nonce),
+		GasLimit:             uint64(*tx.Gas),
+		Amount:               tx.Value.ToInt(),
+		GasPrice:             tx.GasPrice.ToInt(),
+		MaxFeePerGas:         tx.MaxFeePerGas.ToInt(),
+		MaxPriorityFeePerGas: tx.MaxPriorityFeePerGas.ToInt(),
+		AccessList:           tx.AccessList,
+	}
+	if tx.Type != nil {
+		args.TxType = int(*tx.Type)
+	}
+	if tx.Input != nil {
+		args.Data = hex.EncodeToString(*tx.Input)
+	}
+	return args, tx.ChainID.ToInt(), nil
+}
+
+func rawTxRecipient(to []byte) (*common.Address, error) {
+	switch len(to) {
+	case 0:
+		return nil, nil
+	case common.AddressLength:
+		address := common.BytesToAddress(to)
+		return &address, nil
+	}
+	return nil, errors.New("The transaction's `to` must be 20 bytes, or empty to deploy a contract.")
+}
@@ -0,0 +1,223 @@
+package guardian
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/eximchain/go-ethereum/common"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// Unsigned encodings are from go-ethereum v1.13.15's rlp package, and sign to the envelopes in typedtx_test.go
+const (
+	unsignedLegacyRLP        = "0xe9098504a817c80082520894095e7baea6a6c7c4c2dfeb977efac326af552d87880de0b6b3a764000080"
+	unsignedLegacyEIP155RLP  = "0xec098504a817c80082520894095e7baea6a6c7c4c2dfeb977efac326af552d87880de0b6b3a764000080018080"
+	signedLegacyEIP155RLP    = "0xf86c098504a817c80082520894095e7baea6a6c7c4c2dfeb977efac326af552d87880de0b6b3a76400008026a039d40f8cc38a46294414fb8e6a04e8696517e4493a2b0561acbc3f16c663d0eca02ddcfc5c5553d2408b0275ba5b0f9dfe327ad659376128bdef16f22a61771738"
+	unsignedDeploymentRLP    = "0xd8808504a817c800830186a080808560806040528205048080"
+	unsignedAccessListTxRLP  = "0x01f88101038504a817c8008261a894095e7baea6a6c7c4c2dfeb977efac326af552d870a825544f85bf85994095e7baea6a6c7c4c2dfeb977efac326af552d87f842a00000000000000000000000000000000000000000000000000000000000000001a00000000000000000000000000000000000000000000000000000000000000002"
+	unsignedDynamicFeeTxRLP  = "0x02f0010784773594008506fc23ac0082520894095e7baea6a6c7c4c2dfeb977efac326af552d87880de0b6b3a764000080c0"
+	signedDynamicFeeTxRLP    = "0x02f873010784773594008506fc23ac0082520894095e7baea6a6c7c4c2dfeb977efac326af552d87880de0b6b3a764000080c080a072b1a5cf29d8e6ae482b0e949cc0e6372c64a943318d5c77bb895064a0a37092a01539053b4ea8e732cfc91ba8afb2cc468817755b35dd8b3d5dfa276a002ce83d"
+	signedAccessListTxRLP    = "0x01f8c401038504a817c8008261a894095e7baea6a6c7c4c2dfeb977efac326af552d870a825544f85bf85994095e7baea6a6c7c4c2dfeb977efac326af552d87f842a00000000000000000000000000000000000000000000000000000000000000001a0000000000000000000000000000000000000000000000000000000000000000201a07730e5d636640ff4ca61a33b468705ba8e1210d80d88d05a0184a967eab6943ba03436d3af4cdb9badf288dd9fd12a2a057a9b925b1d9c172c73a8790bf1376009"
+	rawTxTestPrivKeyHex      = "b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291"
+	rawTxTestRecipientHex    = "0x095e7baea6a6c7c4c2dfeb977efac326af552d87"
+	unsignedDynamicFeeTxJSON = `{"type":"0x2","chainId":"0x1","nonce":"0x7","maxPriorityFeePerGas":"0x77359400","maxFeePerGas":"0x6fc23ac00","gas":"0x5208","to":"0x095e7baea6a6c7c4c2dfeb977efac326af552d87","value":"0xde0b6b3a7640000","input":"0x","accessList":[],"v":"0x0","r":"0x0","s":"0x0"}`
+)
+
+func TestDecodeUnsignedTxRLP(t *testing.T) {
+	to := common.HexToAddress(rawTxTestRecipientHex)
+	gwei := big.NewInt(1000000000)
+	for _, test := range []struct {
+		name    string
+		txRLP   string
+		want    txArgs
+		chainID int64
+		signed  string
+	}{
+		{
+			name:  "legacy with 6 fields",
+			txRLP: unsignedLegacyRLP,
+			want:  txArgs{Nonce: 9, GasPrice: new(big.Int).Mul(big.NewInt(20), gwei), GasLimit: 21000, To: &to, Amount: new(big.Int).Mul(gwei, gwei)},
+		},
+		{
+			name:    "legacy with the EIP-155 chain ID",
+			txRLP:   unsignedLegacyEIP155RLP,
+			want:    txArgs{Nonce: 9, GasPrice: new(big.Int).Mul(big.NewInt(20), gwei), GasLimit: 21000, To: &to, Amount: new(big.Int).Mul(gwei, gwei)},
+			chainID: 1,
+			signed:  signedLegacyEIP155RLP,
+		},
+		{
+			name:    "legacy deployment with the EIP-155 chain ID",
+			txRLP:   strings.TrimPrefix(unsignedDeploymentRLP, "0x"),
+			want:    txArgs{GasPrice: new(big.Int).Mul(big.NewInt(20), gwei), GasLimit: 100000, Amount: big.NewInt(0), Data: "6080604052"},
+			chainID: 1284,
+		},
+		{
+			name:  "EIP-2930",
+			txRLP: unsignedAccessListTxRLP,
+			want: txArgs{TxType: accessListTxType, Nonce: 3, GasPrice: new(big.Int).Mul(big.NewInt(20), gwei), GasLimit: 25000, To: &to, Amount: big.NewInt(10), Data: "5544",
+				AccessList: []AccessTuple{{Address: to, StorageKeys: []common.Hash{common.HexToHash("0x01"), common.HexToHash("0x02")}}}},
+			chainID: 1,
+			signed:  signedAccessListTxRLP,
+		},
+		{
+			name:  "EIP-1559",
+			txRLP: unsignedDynamicFeeTxRLP,
+			want: txArgs{TxType: dynamicFeeTxType, Nonce: 7, MaxPriorityFeePerGas: new(big.Int).Mul(big.NewInt(2), gwei), MaxFeePerGas: new(big.Int).Mul(big.NewInt(30), gwei),
+				GasLimit: 21000, To: &to, Amount: new(big.Int).Mul(gwei, gwei)},
+			chainID: 1,
+			signed:  signedDynamicFeeTxRLP,
+		},
+	} {
+		args, chainID, err := decodeUnsignedTxRLP(test.txRLP)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if test.chainID == 0 && chainID != nil && chainID.Sign() != 0 {
+			t.Errorf("%s: decoded chain ID %s, want none", test.name, chainID)
+		}
+		if test.chainID != 0 && (chainID == nil || chainID.Int64() != test.chainID) {
+			t.Errorf("%s: decoded chain ID %v, want %d", test.name, chainID, test.chainID)
+		}
+		checkDecodedTxArgs(t, test.name, args, &test.want)
+
+		if test.signed == "" {
+			continue
+		}
+		args.ChainID = int(test.chainID)
+		_, rlpTx, err := args.signWithHexKey(rawTxTestPrivKeyHex)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if rlpTx != test.signed {
+			t.Errorf("%s: signed to\n%s\nwant\n%s", test.name, rlpTx, test.signed)
+		}
+	}
+
+	for name, txRLP := range map[string]string{
+		"signed legacy":    signedLegacyEIP155RLP,
+		"signed EIP-2930":  signedAccessListTxRLP,
+		"signed EIP-1559":  signedDynamicFeeTxRLP,
+		"legacy with 7":    "0xea098504a817c80082520894095e7baea6a6c7c4c2dfeb977efac326af552d87880de0b6b3a76400008001",
+		"unsupported type": "0x03c0",
+		"empty":            "0x",
+		"not hex":          "0xzz",
+		"short recipient":  "0xd0098504a817c80082520883aabbcc8080",
+		"truncated":        unsignedLegacyEIP155RLP[:len(unsignedLegacyEIP155RLP)-2],
+	} {
+		if _, _, err := decodeUnsignedTxRLP(txRLP); err == nil {
+			t.Errorf("%s: decoded without an error", name)
+		}
+	}
+}
+
+func TestDecodeUnsignedTxJSON(t *testing.T) {
+	to := common.HexToAddress(rawTxTestRecipientHex)
+	gwei := big.NewInt(1000000000)
+	args, chainID, err := decodeUnsignedTxJSON(unsignedDynamicFeeTxJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chainID == nil || chainID.Int64() != 1 {
+		t.Errorf("decoded chain ID %v, want 1", chainID)
+	}
+	checkDecodedTxArgs(t, "EIP-1559 JSON", args, &txArgs{TxType: dynamicFeeTxType, Nonce: 7, MaxPriorityFeePerGas: new(big.Int).Mul(big.NewInt(2), gwei),
+		MaxFeePerGas: new(big.Int).Mul(big.NewInt(30), gwei), GasLimit: 21000, To: &to, Amount: new(big.Int).Mul(gwei, gwei)})
+	args.ChainID = 1
+	_, rlpTx, err := args.signWithHexKey(rawTxTestPrivKeyHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rlpTx != signedDynamicFeeTxRLP {
+		t.Errorf("JSON signed to\n%s\nwant\n%s", rlpTx, signedDynamicFeeTxRLP)
+	}
+
+	args, chainID, err = decodeUnsignedTxJSON(`{"nonce":"0x0","gasPrice":"0x4a817c800","gas":"0x186a0","to":null,"value":"0x0","input":"0x6080604052"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chainID != nil {
+		t.Errorf("decoded chain ID %s from JSON without one", chainID)
+	}
+	checkDecodedTxArgs(t, "legacy deployment JSON", args, &txArgs{GasPrice: new(big.Int).Mul(big.NewInt(20), gwei), GasLimit: 100000, Amount: big.NewInt(0), Data: "6080604052"})
+
+	for name, txJSON := range map[string]string{
+		"signed":   strings.Replace(unsignedDynamicFeeTxJSON, `"v":"0x0"`, `"v":"0x1"`, 1),
+		"no nonce": `{"gasPrice":"0x1","gas":"0x5208"}`,
+		"no gas":   `{"nonce":"0x0","gasPrice":"0x1"}`,
+		"not JSON": `nonce=0`,
+	} {
+		if _, _, err := decodeUnsignedTxJSON(txJSON); err == nil {
+			t.Errorf("%s: decoded without an error", name)
+		}
+	}
+}
+
+func TestRawTxChainID(t *testing.T) {
+	schema := map[string]*framework.FieldSchema{
+		"tx_rlp":   &framework.FieldSchema{Type: framework.TypeString},
+		"tx_json":  &framework.FieldSchema{Type: framework.TypeString},
+		"chain":    &framework.FieldSchema{Type: framework.TypeString},
+		"chain_id": &framework.FieldSchema{Type: framework.TypeInt},
+	}
+	for _, test := range []struct {
+		name    string
+		raw     map[string]interface{}
+		chainID int
+		fails   bool
+	}{
+		{name: "legacy takes its encoded chain ID", raw: map[string]interface{}{"tx_rlp": unsignedLegacyEIP155RLP}, chainID: 1},
+		{name: "legacy with a matching chain_id", raw: map[string]interface{}{"tx_rlp": unsignedLegacyEIP155RLP, "chain_id": 1}, chainID: 1},
+		{name: "legacy with another chain_id", raw: map[string]interface{}{"tx_rlp": unsignedLegacyEIP155RLP, "chain_id": 4}, fails: true},
+		{name: "6 fields take chain_id", raw: map[string]interface{}{"tx_rlp": unsignedLegacyRLP, "chain_id": 4}, chainID: 4},
+		{name: "EIP-2930 with another chain_id", raw: map[string]interface{}{"tx_rlp": unsignedAccessListTxRLP, "chain_id": 5}, fails: true},
+		{name: "EIP-1559 with another chain_id", raw: map[string]interface{}{"tx_rlp": unsignedDynamicFeeTxRLP, "chain_id": 1284}, fails: true},
+		{name: "JSON with another chain_id", raw: map[string]interface{}{"tx_json": unsignedDynamicFeeTxJSON, "chain_id": 4}, fails: true},
+		{name: "both encodings", raw: map[string]interface{}{"tx_rlp": unsignedDynamicFeeTxRLP, "tx_json": unsignedDynamicFeeTxJSON}, fails: true},
+	} {
+		args, err := rawTxArgsFromData(&framework.FieldData{Raw: test.raw, Schema: schema})
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: accepted for chain ID %d", test.name, args.ChainID)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if args.ChainID != test.chainID {
+			t.Errorf("%s: chain ID %d, want %d", test.name, args.ChainID, test.chainID)
+		}
+	}
+}
+
+func checkDecodedTxArgs(t *testing.T, name string, got, want *txArgs) {
+	t.Helper()
+	if got.TxType != want.TxType || got.Nonce != want.Nonce || got.GasLimit != want.GasLimit || got.Data != want.Data {
+		t.Errorf("%s: decoded type %d nonce %d gas %d data %q", name, got.TxType, got.Nonce, got.GasLimit, got.Data)
+	}
+	if (got.To == nil) != (want.To == nil) || (got.To != nil && *got.To != *want.To) {
+		t.Errorf("%s: decoded recipient %v, want %v", name, got.To, want.To)
+	}
+	for field, values := range map[string][2]*big.Int{
+		"value":                    {got.Amount, want.Amount},
+		"gas price":                {got.GasPrice, want.GasPrice},
+		"max fee per gas":          {got.MaxFeePerGas, want.MaxFeePerGas},
+		"max priority fee per gas": {got.MaxPriorityFeePerGas, want.MaxPriorityFeePerGas},
+	} {
+		if values[1] == nil {
+			if values[0] != nil && values[0].Sign() != 0 {
+				t.Errorf("%s: decoded %s %s, want none", name, field, values[0])
+			}
+		} else if values[0] == nil || values[0].Cmp(values[1]) != 0 {
+			t.Errorf("%s: decoded %s %v, want %s", name, field, values[0], values[1])
+		}
+	}
+	if len(got.AccessList) != len(want.AccessList) {
+		t.Fatalf("%s: decoded access list %+v, want %+v", name, got.AccessList, want.AccessList)
+	}
+	for i := range want.AccessList {
+		if got.AccessList[i].Address != want.AccessList[i].Address || len(got.AccessList[i].StorageKeys) != len(want.AccessList[i].StorageKeys) {
+			t.Errorf("%s: decoded access list %+v, want %+v", name, got.AccessList, want.AccessList)
+		}
+	}
+}
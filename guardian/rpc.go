@@ -0,0 +1,111 @@
+package guardian
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/eximchain/go-ethereum/common"
+	"github.com/eximchain/go-ethereum/common/hexutil"
+)
+
+// rpcTimeout : How long a single call to a node may take
+const rpcTimeout = 10 * time.Second
+
+// chainNode : A chain's JSON-RPC node, for the few calls Guardian makes to it.  They are plain
+// HTTP requests, so talking to a node needs nothing vendored beyond go-ethereum's hex types.
+type chainNode struct {
+	url        string
+	httpClient *http.Client
+}
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error : The node's message verbatim, so callers see exactly why it refused a request
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+func newChainNode(nodeURL string) (*chainNode, error) {
+	parsed, err := url.Parse(nodeURL)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("rpc_url %s must be an http or https URL", nodeURL)
+	}
+	return &chainNode{url: nodeURL, httpClient: &http.Client{Timeout: rpcTimeout}}, nil
+}
+
+// call : Makes one JSON-RPC request, decoding its result into result
+func (node *chainNode) call(ctx context.Context, result interface{}, method string, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: 1, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, node.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := node.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned HTTP %d", method, resp.StatusCode)
+	}
+
+	var decoded rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return fmt.Errorf("%s returned an invalid response: %v", method, err)
+	}
+	if decoded.Error != nil {
+		return decoded.Error
+	}
+	if len(decoded.Result) == 0 || string(decoded.Result) == "null" {
+		return fmt.Errorf("%s returned no result", method)
+	}
+	return json.Unmarshal(decoded.Result, result)
+}
+
+// PendingNonceAt : The nonce of the address's next transaction, counting ones in the node's pool
+func (node *chainNode) PendingNonceAt(ctx context.Context, address string) (uint64, error) {
+	var nonce hexutil.Uint64
+	if err := node.call(ctx, &nonce, "eth_getTransactionCount", address, "pending"); err != nil {
+		return 0, err
+	}
+	return uint64(nonce), nil
+}
+
+// SendRawTransaction : Submits a signed transaction of any type, returning the hash the node reports for it
+func (node *chainNode) SendRawTransaction(ctx context.Context, signedRLP string) (string, error) {
+	var hash common.Hash
+	if err := node.call(ctx, &hash, "eth_sendRawTransaction", signedRLP); err != nil {
+		return "", err
+	}
+	return hash.Hex(), nil
+}
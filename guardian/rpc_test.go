@@ -0,0 +1,66 @@
+package guardian
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChainNode(t *testing.T) {
+	signedTx := "0x02f873010784773594008506fc23ac0082520894095e7baea6a6c7c4c2dfeb977efac326af552d87880de0b6b3a764000080c080a072b1a5cf29d8e6ae482b0e949cc0e6372c64a943318d5c77bb895064a0a37092a01539053b4ea8e732cfc91ba8afb2cc468817755b35dd8b3d5dfa276a002ce83d"
+	txHash := "0x8a2479881d434989f13bc1779b9b9b5fe995c64f52b37f58037639a855307ed1"
+	address := "0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b"
+	refuse := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req rpcRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case refuse:
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"nonce too low"}}`))
+		case req.Method == "eth_getTransactionCount" && len(req.Params) == 2 && req.Params[0] == address && req.Params[1] == "pending":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x2a"}`))
+		case req.Method == "eth_sendRawTransaction" && len(req.Params) == 1 && req.Params[0] == signedTx:
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"` + txHash + `"}`))
+		default:
+			t.Errorf("unexpected request %+v", req)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	node, err := newChainNode(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := node.PendingNonceAt(ctx, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce != 42 {
+		t.Errorf("pending nonce %d, want 42", nonce)
+	}
+	// Typed transactions are passed through as they are, the node reports their hash
+	hash, err := node.SendRawTransaction(ctx, signedTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != txHash {
+		t.Errorf("tx hash %s, want %s", hash, txHash)
+	}
+
+	refuse = true
+	if _, err := node.SendRawTransaction(ctx, signedTx); err == nil || err.Error() != "nonce too low" {
+		t.Errorf("refused with %v, want the node's message", err)
+	}
+
+	if _, err := newChainNode("ws://localhost:8546"); err == nil {
+		t.Error("accepted a websocket rpc_url")
+	}
+}
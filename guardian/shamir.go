@@ -0,0 +1,118 @@
+package guardian
+
+import (
+	"errors"
+	"fmt"
+
+	uuid "github.com/hashicorp/go-uuid"
+)
+
+// Shares use the same layout as Vault's unseal keys: one y byte per secret byte,
+// followed by the share's x coordinate.  Arithmetic is in GF(2^8) with the AES polynomial.
+
+// SplitSecret : Splits the secret into `parts` shares, any `threshold` of which can rebuild it.
+func SplitSecret(secret []byte, parts, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("cannot split an empty secret")
+	}
+	if threshold < 2 || threshold > parts || parts > 255 {
+		return nil, errors.New("threshold must be at least 2 and at most the number of shares, which is at most 255")
+	}
+
+	shares := make([][]byte, parts)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+	// Each secret byte is the constant term of its own random polynomial of degree threshold-1
+	coefficients := make([]byte, threshold)
+	defer zeroBytes(coefficients)
+	for byteIndex, secretByte := range secret {
+		random, err := uuid.GenerateRandomBytes(threshold - 1)
+		if err != nil {
+			return nil, err
+		}
+		coefficients[0] = secretByte
+		copy(coefficients[1:], random)
+		zeroBytes(random)
+		for _, share := range shares {
+			share[byteIndex] = gfEvaluate(coefficients, share[len(secret)])
+		}
+	}
+	return shares, nil
+}
+
+// CombineShares : Rebuilds a secret from at least threshold shares made by SplitSecret.
+func CombineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least two shares are required")
+	}
+	shareLen := len(shares[0])
+	if shareLen < 2 {
+		return nil, errors.New("shares are too short")
+	}
+	xs := make([]byte, len(shares))
+	seen := map[byte]bool{}
+	for i, share := range shares {
+		if len(share) != shareLen {
+			return nil, errors.New("all shares must be the same length")
+		}
+		x := share[shareLen-1]
+		if x == 0 || seen[x] {
+			return nil, fmt.Errorf("share %d is a duplicate or malformed", i+1)
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+
+	// Lagrange interpolation at x = 0, one secret byte at a time
+	secret := make([]byte, shareLen-1)
+	for byteIndex := range secret {
+		var value byte
+		for i, share := range shares {
+			basis := byte(1)
+			for j := range shares {
+				if i != j {
+					basis = gfMul(basis, gfDiv(xs[j], xs[i]^xs[j]))
+				}
+			}
+			value ^= gfMul(share[byteIndex], basis)
+		}
+		secret[byteIndex] = value
+	}
+	return secret, nil
+}
+
+// gfEvaluate : Evaluates the polynomial with the given coefficients, lowest degree first, at x
+func gfEvaluate(coefficients []byte, x byte) byte {
+	var result byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = gfMul(result, x) ^ coefficients[i]
+	}
+	return result
+}
+
+func gfMul(a, b byte) byte {
+	var product byte
+	for b != 0 {
+		if b&1 != 0 {
+			product ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return product
+}
+
+// gfDiv : a / b, b must not be zero.  The inverse of b is b^254.
+func gfDiv(a, b byte) byte {
+	inverse := byte(1)
+	for i := 0; i < 254; i++ {
+		inverse = gfMul(inverse, b)
+	}
+	return gfMul(a, inverse)
+}
@@ -0,0 +1,86 @@
+package guardian
+
+import (
+	"bytes"
+	"testing"
+)
+
+// shareSubsets : Every subset of the shares, as the indexes picked from them
+func shareSubsets(parts int) [][]int {
+	subsets := [][]int{}
+	for mask := 1; mask < 1<<uint(parts); mask++ {
+		subset := []int{}
+		for i := 0; i < parts; i++ {
+			if mask&(1<<uint(i)) != 0 {
+				subset = append(subset, i)
+			}
+		}
+		subsets = append(subsets, subset)
+	}
+	return subsets
+}
+
+func TestSplitCombineEverySubset(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	for _, scheme := range [][2]int{{2, 2}, {2, 3}, {3, 5}, {4, 6}, {5, 5}} {
+		threshold, parts := scheme[0], scheme[1]
+		shares, err := SplitSecret(secret, parts, threshold)
+		if err != nil {
+			t.Fatalf("%d of %d: %v", threshold, parts, err)
+		}
+		for _, subset := range shareSubsets(parts) {
+			picked := make([][]byte, len(subset))
+			for i, index := range subset {
+				picked[i] = shares[index]
+			}
+			combined, err := CombineShares(picked)
+			switch {
+			case len(subset) < 2:
+				if err == nil {
+					t.Errorf("%d of %d: a single share was combined", threshold, parts)
+				}
+			case len(subset) < threshold:
+				// Too few shares interpolate to some other secret
+				if err == nil && bytes.Equal(combined, secret) {
+					t.Errorf("%d of %d: shares %v rebuilt the secret below the threshold", threshold, parts, subset)
+				}
+			default:
+				if err != nil {
+					t.Errorf("%d of %d: shares %v: %v", threshold, parts, subset, err)
+				} else if !bytes.Equal(combined, secret) {
+					t.Errorf("%d of %d: shares %v rebuilt %x", threshold, parts, subset, combined)
+				}
+			}
+		}
+	}
+}
+
+func TestSplitSecretRefuses(t *testing.T) {
+	cases := map[string]struct {
+		secret           []byte
+		parts, threshold int
+	}{
+		"empty secret":         {nil, 3, 2},
+		"threshold of one":     {[]byte("secret"), 3, 1},
+		"threshold over parts": {[]byte("secret"), 3, 4},
+		"too many parts":       {[]byte("secret"), 256, 3},
+	}
+	for name, c := range cases {
+		if _, err := SplitSecret(c.secret, c.parts, c.threshold); err == nil {
+			t.Errorf("%s: was split", name)
+		}
+	}
+}
+
+func TestCombineSharesRefuses(t *testing.T) {
+	shares, err := SplitSecret([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CombineShares([][]byte{shares[0], shares[0]}); err == nil {
+		t.Error("combined a duplicated share")
+	}
+	if _, err := CombineShares([][]byte{shares[0], shares[1][1:]}); err == nil {
+		t.Error("combined shares of different lengths")
+	}
+}
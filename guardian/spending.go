@@ -0,0 +1,319 @@
+package guardian
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// SpendingLimit : Caps on the wei a user may send on any one chain, nil fields are uncapped.
+// Limits are set per user under limits/users/ and per Okta group under limits/groups/.
+type SpendingLimit struct {
+	PerTx *big.Int `json:"per_tx,omitempty"`
+	// Daily and Monthly cap what was sent over the rolling 24 hours and 30 days before signing
+	Daily   *big.Int `json:"daily,omitempty"`
+	Monthly *big.Int `json:"monthly,omitempty"`
+}
+
+const (
+	userLimitStoragePrefix  = "limits/users/"
+	groupLimitStoragePrefix = "limits/groups/"
+	spendingStoragePrefix   = "spending/"
+
+	dailyWindow   = 24 * time.Hour
+	monthlyWindow = 30 * 24 * time.Hour
+)
+
+// spend : Value sent by one signed transaction
+type spend struct {
+	At  time.Time `json:"at"`
+	Wei *big.Int  `json:"wei"`
+}
+
+// spendingState : What a user has sent on one chain over the last 30 days, oldest first
+type spendingState struct {
+	Spends []spend `json:"spends"`
+}
+
+func spendingStoragePath(username string, chainID int) string {
+	return fmt.Sprintf("%s%s/%d", spendingStoragePrefix, username, chainID)
+}
+
+// spentSince : Total sent at or after the time
+func (st *spendingState) spentSince(since time.Time) *big.Int {
+	total := new(big.Int)
+	for _, sent := range st.Spends {
+		if !sent.At.Before(since) {
+			total.Add(total, sent.Wei)
+		}
+	}
+	return total
+}
+
+// prune : Forgets spends too old to count against any limit
+func (st *spendingState) prune(now time.Time) {
+	kept := st.Spends[:0]
+	for _, sent := range st.Spends {
+		if now.Sub(sent.At) < monthlyWindow {
+			kept = append(kept, sent)
+		}
+	}
+	st.Spends = kept
+}
+
+// remove : Forgets spends which turned out not to be signed
+func (st *spendingState) remove(spends []spend) {
+	for _, unsent := range spends {
+		for i, sent := range st.Spends {
+			if sent.At.Equal(unsent.At) && sent.Wei.Cmp(unsent.Wei) == 0 {
+				st.Spends = append(st.Spends[:i], st.Spends[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// violations : Describes how sending amounts on the chain, whose total is total, would break the limit
+func (limit *SpendingLimit) violations(chainID int, st *spendingState, amounts []*big.Int, total *big.Int, now time.Time) []string {
+	violations := []string{}
+	if limit.PerTx != nil {
+		for _, amount := range amounts {
+			if amount.Cmp(limit.PerTx) > 0 {
+				violations = append(violations, fmt.Sprintf("%s wei on chain ID %d is above the limit of %s wei per transaction", amount, chainID, limit.PerTx))
+				break
+			}
+		}
+	}
+	windows := []struct {
+		cap    *big.Int
+		window time.Duration
+		name   string
+	}{
+		{limit.Daily, dailyWindow, "24 hours"},
+		{limit.Monthly, monthlyWindow, "30 days"},
+	}
+	for _, window := range windows {
+		if window.cap == nil {
+			continue
+		}
+		remaining := new(big.Int).Sub(window.cap, st.spentSince(now.Add(-window.window)))
+		if remaining.Sign() < 0 {
+			remaining.SetInt64(0)
+		}
+		if total.Cmp(remaining) > 0 {
+			violations = append(violations, fmt.Sprintf("%s wei on chain ID %d would exceed the limit of %s wei per %s, of which %s wei remains", total, chainID, window.cap, window.name, remaining))
+		}
+	}
+	return violations
+}
+
+// mergeLimits : The tightest of each cap across the limits
+func mergeLimits(limits []*SpendingLimit) *SpendingLimit {
+	tightest := func(current, next *big.Int) *big.Int {
+		if current == nil || (next != nil && next.Cmp(current) < 0) {
+			return next
+		}
+		return current
+	}
+	merged := &SpendingLimit{}
+	for _, limit := range limits {
+		merged.PerTx = tightest(merged.PerTx, limit.PerTx)
+		merged.Daily = tightest(merged.Daily, limit.Daily)
+		merged.Monthly = tightest(merged.Monthly, limit.Monthly)
+	}
+	return merged
+}
+
+func (b *backend) readSpendingLimit(ctx context.Context, s logical.Storage, path string) (*SpendingLimit, error) {
+	entry, err := s.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var limit SpendingLimit
+	if err := entry.DecodeJSON(&limit); err != nil {
+		return nil, err
+	}
+	return &limit, nil
+}
+
+func (b *backend) writeSpendingLimit(ctx context.Context, s logical.Storage, path string, limit *SpendingLimit) error {
+	entry, err := logical.StorageEntryJSON(path, limit)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// userSpendingLimit : The caps the user signs under, field by field.  A cap set on the user's own limit
+// wins, even over tighter group caps, so an admin can raise one user's allowance; caps the user's limit
+// leaves out come from the tightest of their Okta groups' limits.
+func (b *backend) userSpendingLimit(ctx context.Context, s logical.Storage, user *policyUser) (*SpendingLimit, error) {
+	own, err := b.readSpendingLimit(ctx, s, userLimitStoragePrefix+user.username)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := b.groupsWithPolicy(ctx, s, user, groupLimitStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+	var limits []*SpendingLimit
+	for _, group := range groups {
+		limit, err := b.readSpendingLimit(ctx, s, groupLimitStoragePrefix+group)
+		if err != nil {
+			return nil, err
+		}
+		if limit != nil {
+			limits = append(limits, limit)
+		}
+	}
+	if len(limits) == 0 {
+		return own, nil
+	}
+	merged := mergeLimits(limits)
+	if own == nil {
+		return merged, nil
+	}
+	if own.PerTx != nil {
+		merged.PerTx = own.PerTx
+	}
+	if own.Daily != nil {
+		merged.Daily = own.Daily
+	}
+	if own.Monthly != nil {
+		merged.Monthly = own.Monthly
+	}
+	return merged, nil
+}
+
+func (b *backend) readSpendingState(ctx context.Context, s logical.Storage, username string, chainID int) (*spendingState, error) {
+	entry, err := s.Get(ctx, spendingStoragePath(username, chainID))
+	if err != nil {
+		return nil, err
+	}
+	var state spendingState
+	if entry != nil {
+		if err := entry.DecodeJSON(&state); err != nil {
+			return nil, err
+		}
+	}
+	return &state, nil
+}
+
+func (b *backend) writeSpendingState(ctx context.Context, s logical.Storage, username string, chainID int, state *spendingState) error {
+	entry, err := logical.StorageEntryJSON(spendingStoragePath(username, chainID), state)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// spendsByChain : The value each transaction sends, grouped by chain, leaving out ones which send nothing
+func spendsByChain(txs []*txArgs) map[int][]*big.Int {
+	byChain := map[int][]*big.Int{}
+	for _, args := range txs {
+		if args.Amount != nil && args.Amount.Sign() > 0 {
+			byChain[args.ChainID] = append(byChain[args.ChainID], args.Amount)
+		}
+	}
+	return byChain
+}
+
+func sumWei(amounts []*big.Int) *big.Int {
+	total := new(big.Int)
+	for _, amount := range amounts {
+		total.Add(total, amount)
+	}
+	return total
+}
+
+// spendingViolations : How signing the transactions would break the user's spending limit, without recording anything
+func (b *backend) spendingViolations(ctx context.Context, s logical.Storage, user *policyUser, txs []*txArgs) ([]string, error) {
+	byChain := spendsByChain(txs)
+	if len(byChain) == 0 {
+		return []string{}, nil
+	}
+	limit, err := b.userSpendingLimit(ctx, s, user)
+	if err != nil || limit == nil {
+		return []string{}, err
+	}
+	now := time.Now().UTC()
+	violations := []string{}
+	for chainID, amounts := range byChain {
+		state, err := b.readSpendingState(ctx, s, user.username, chainID)
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, limit.violations(chainID, state, amounts, sumWei(amounts), now)...)
+	}
+	return violations, nil
+}
+
+// reserveSpending : Records what the transactions send against the user's spending limit, unless that would
+// break it, in which case the violations are returned and nothing is recorded.  The returned release
+// forgets the spending again, for when the transactions could not be signed.
+func (b *backend) reserveSpending(ctx context.Context, s logical.Storage, user *policyUser, txs []*txArgs) (release func() error, violations []string, err error) {
+	username := user.username
+	release = func() error { return nil }
+	byChain := spendsByChain(txs)
+	if len(byChain) == 0 {
+		return release, []string{}, nil
+	}
+	limit, err := b.userSpendingLimit(ctx, s, user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b.spendingLock.Lock()
+	defer b.spendingLock.Unlock()
+	now := time.Now().UTC()
+	states := map[int]*spendingState{}
+	violations = []string{}
+	for chainID, amounts := range byChain {
+		state, err := b.readSpendingState(ctx, s, username, chainID)
+		if err != nil {
+			return nil, nil, err
+		}
+		state.prune(now)
+		if limit != nil {
+			violations = append(violations, limit.violations(chainID, state, amounts, sumWei(amounts), now)...)
+		}
+		states[chainID] = state
+	}
+	if len(violations) > 0 {
+		return nil, violations, nil
+	}
+
+	// Spending is recorded even without a limit, so a limit set later counts what came before it
+	recorded := map[int][]spend{}
+	for chainID, amounts := range byChain {
+		for _, amount := range amounts {
+			recorded[chainID] = append(recorded[chainID], spend{At: now, Wei: amount})
+		}
+		states[chainID].Spends = append(states[chainID].Spends, recorded[chainID]...)
+		if err := b.writeSpendingState(ctx, s, username, chainID, states[chainID]); err != nil {
+			return nil, nil, err
+		}
+	}
+	release = func() error {
+		b.spendingLock.Lock()
+		defer b.spendingLock.Unlock()
+		for chainID, spends := range recorded {
+			state, err := b.readSpendingState(ctx, s, username, chainID)
+			if err != nil {
+				return err
+			}
+			state.remove(spends)
+			if err := b.writeSpendingState(ctx, s, username, chainID, state); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return release, violations, nil
+}
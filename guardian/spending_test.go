@@ -0,0 +1,45 @@
+package guardian
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestUserSpendingLimitMergesPerCap(t *testing.T) {
+	ctx := context.Background()
+	b := Backend(&logical.BackendConfig{})
+	s, _ := testStorage(t, b)
+	user := &policyUser{username: "alice", groups: []string{"traders", "interns"}, fetched: true}
+
+	limits := map[string]*SpendingLimit{
+		groupLimitStoragePrefix + "traders": {PerTx: big.NewInt(10), Daily: big.NewInt(50), Monthly: big.NewInt(500)},
+		groupLimitStoragePrefix + "interns": {Daily: big.NewInt(20)},
+		userLimitStoragePrefix + "alice":    {Daily: big.NewInt(100)},
+	}
+	for path, limit := range limits {
+		if err := b.writeSpendingLimit(ctx, s, path, limit); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	limit, err := b.userSpendingLimit(ctx, s, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// alice's own daily cap wins over the groups', the others come from the tightest group
+	if limit.PerTx.Int64() != 10 || limit.Daily.Int64() != 100 || limit.Monthly.Int64() != 500 {
+		t.Errorf("merged limit is per_tx %s, daily %s, monthly %s", limit.PerTx, limit.Daily, limit.Monthly)
+	}
+
+	bob := &policyUser{username: "bob", groups: []string{"traders", "interns"}, fetched: true}
+	limit, err = b.userSpendingLimit(ctx, s, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit.PerTx.Int64() != 10 || limit.Daily.Int64() != 20 || limit.Monthly.Int64() != 500 {
+		t.Errorf("group limit is per_tx %s, daily %s, monthly %s", limit.PerTx, limit.Daily, limit.Monthly)
+	}
+}
@@ -0,0 +1,292 @@
+package guardian
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/eximchain/go-ethereum/common"
+	"github.com/eximchain/go-ethereum/common/math"
+	"github.com/eximchain/go-ethereum/core/types"
+	"github.com/eximchain/go-ethereum/crypto"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// txArgs : Transaction parameters read from the fields added by withTxFields.
+// A nil To means the transaction deploys a contract, and Data holds its bytecode and constructor arguments.
+type txArgs struct {
+	// ChainName and ChainID are as the caller gave them, until applyChain settles them and sets Chain
+	ChainName string
+	ChainID   int
+	Chain     *ChainProfile
+	To        *common.Address
+	Nonce     uint64
+	// AutoNonce is set when the caller left out the nonce, so Guardian assigns the next one for the address
+	AutoNonce bool
+	// nonceUse is what recording a nonce the caller chose changed, so it can be undone if signing fails
+	nonceUse *nonceUse
+	GasLimit uint64
+	Amount   *big.Int
+	GasPrice *big.Int
+	Data     string
+
+	// Quorum private transactions, whose Data is the transaction manager's payload hash
+	Private bool
+
+	// EIP-2718 typed transactions only
+	TxType               int
+	AccessList           []AccessTuple
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+}
+
+// txArgsFromData : Fetches arguments, validates required ones, nils out ones which don't need to be there
+func txArgsFromData(data *framework.FieldData) (*txArgs, error) {
+	nonce, hasNonce := data.GetOk("nonce")
+	to, hasTo := data.GetOk("to")
+	gasLimit, hasGasLimit := data.GetOk("gas_limit")
+	bytecode, hasBytecode := data.GetOk("bytecode")
+	private, _ := data.GetOk("private")
+	isPrivate := private != nil && private.(bool)
+	if !(hasTo || hasBytecode || isPrivate) {
+		return nil, errors.New("Missing required information; please at least supply a value for `to` (or `bytecode` to deploy a contract).")
+	}
+
+	args := &txArgs{
+		ChainName: data.Get("chain").(string),
+		AutoNonce: !hasNonce,
+		Data:      strings.TrimPrefix(data.Get("data").(string), "0x"),
+	}
+	if chainID, hasChainID := data.GetOk("chain_id"); hasChainID {
+		if chainID.(int) <= 0 {
+			return nil, errors.New("`chain_id` must be a positive integer.")
+		}
+		args.ChainID = chainID.(int)
+	}
+	if hasGasLimit {
+		if gasLimit.(int) <= 0 {
+			return nil, errors.New("`gas_limit` must be a positive integer.")
+		}
+		args.GasLimit = uint64(gasLimit.(int))
+	}
+	if hasNonce {
+		if nonce.(int) < 0 {
+			return nil, errors.New("`nonce` cannot be negative.")
+		}
+		args.Nonce = uint64(nonce.(int))
+	}
+	if hasBytecode {
+		if hasTo {
+			return nil, errors.New("Omit `to` when deploying `bytecode`, the contract address is derived from the sender and nonce.")
+		}
+		if args.Data != "" {
+			return nil, errors.New("Pass constructor arguments in `constructor_args` rather than `data` when deploying `bytecode`.")
+		}
+		code := strings.TrimPrefix(bytecode.(string), "0x")
+		if code == "" {
+			return nil, errors.New("`bytecode` must not be empty.")
+		}
+		args.Data = code
+		if constructorArgs, hasConstructorArgs := data.GetOk("constructor_args"); hasConstructorArgs {
+			args.Data += strings.TrimPrefix(constructorArgs.(string), "0x")
+		}
+	} else if hasTo {
+		if !common.IsHexAddress(to.(string)) {
+			return nil, errors.New("Invalid `to`, it must be a 20 byte hex address.")
+		}
+		toAddress := common.HexToAddress(to.(string))
+		args.To = &toAddress
+	}
+	if gasPrice, hasGasPrice := data.GetOk("gas_price"); hasGasPrice {
+		parsed, err := parseWei(gasPrice.(string))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid `gas_price`: %v", err)
+		}
+		args.GasPrice = parsed
+	}
+	if amount, hasAmount := data.GetOk("amount"); hasAmount {
+		parsed, err := parseWei(amount.(string))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid `amount`: %v", err)
+		}
+		args.Amount = parsed
+	}
+	if txType, hasTxType := data.GetOk("tx_type"); hasTxType {
+		args.TxType = txType.(int)
+	}
+	if accessList, hasAccessList := data.GetOk("access_list"); hasAccessList {
+		parsed, err := parseAccessList(accessList.(string))
+		if err != nil {
+			return nil, err
+		}
+		args.AccessList = parsed
+	}
+	if maxFee, hasMaxFee := data.GetOk("max_fee_per_gas"); hasMaxFee {
+		parsed, err := parseWei(maxFee.(string))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid `max_fee_per_gas`: %v", err)
+		}
+		args.MaxFeePerGas = parsed
+	}
+	if maxPriorityFee, hasMaxPriorityFee := data.GetOk("max_priority_fee_per_gas"); hasMaxPriorityFee {
+		parsed, err := parseWei(maxPriorityFee.(string))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid `max_priority_fee_per_gas`: %v", err)
+		}
+		args.MaxPriorityFeePerGas = parsed
+	}
+	if err := args.validateTxType(); err != nil {
+		return nil, err
+	}
+	if isPrivate {
+		if hasBytecode || args.Data != "" {
+			return nil, errors.New("Private transactions carry no `data` or `bytecode`, store the payload with the transaction manager and pass its `private_payload_hash`.")
+		}
+		if args.TxType != legacyTxType {
+			return nil, errors.New("Private transactions must have a `tx_type` of 0.")
+		}
+		payloadHash, hasPayloadHash := data.GetOk("private_payload_hash")
+		if !hasPayloadHash {
+			return nil, errors.New("Private transactions require the `private_payload_hash` from the transaction manager.")
+		}
+		decoded, err := parsePrivatePayloadHash(payloadHash.(string))
+		if err != nil {
+			return nil, err
+		}
+		args.Private = true
+		args.Data = hex.EncodeToString(decoded)
+	}
+	return args, nil
+}
+
+// signWithHexKey : Signs the args as a legacy EIP-155 transaction, a Quorum private transaction,
+// or as the EIP-2718 envelope of their tx_type
+func (args *txArgs) signWithHexKey(privKeyHex string) (jsonTx, rlpTx string, err error) {
+	if args.Private {
+		return signPrivateTxWithHexKey(args, privKeyHex)
+	}
+	if args.TxType == legacyTxType {
+		return SignTxWithHexKey(args.ChainID, privKeyHex, args.Data, args.To, args.Nonce, args.GasLimit, args.Amount, args.GasPrice)
+	}
+	return signTypedTxWithHexKey(args, privKeyHex)
+}
+
+// SigningHash : The hash signWithHexKey would sign, which needs no key to compute
+func (args *txArgs) SigningHash() ([]byte, error) {
+	if args.Private || args.TxType == legacyTxType {
+		tx, err := newLegacyTx(args.Data, args.To, args.Nonce, args.GasLimit, args.Amount, args.GasPrice)
+		if err != nil {
+			return nil, err
+		}
+		var signer types.Signer = types.NewEIP155Signer(big.NewInt(int64(args.ChainID)))
+		if args.Private {
+			signer = quorumPrivateSigner{}
+		}
+		return signer.Hash(tx).Bytes(), nil
+	}
+	payload, err := newTypedTxPayload(args)
+	if err != nil {
+		return nil, err
+	}
+	return payload.signingHash()
+}
+
+// weiUnitDecimals : The units amounts may be given in, by how many decimal places of wei they hold
+var weiUnitDecimals = map[string]int{
+	"wei":   0,
+	"gwei":  9,
+	"ether": 18,
+}
+
+var (
+	weiDecimalRegex = regexp.MustCompile(`^([0-9]+)(?:\.([0-9]+))?\s*([a-z]*)$`)
+	weiHexRegex     = regexp.MustCompile(`^0x[0-9a-f]+$`)
+)
+
+// parseWei : Parses a decimal or 0x prefixed hex amount of wei, up to 2^256-1.  Decimal amounts may end
+// in a wei, gwei or ether unit, and may have a fractional part if it comes to a whole number of wei.
+func parseWei(value string) (*big.Int, error) {
+	str := strings.ToLower(strings.TrimSpace(value))
+	if strings.HasPrefix(str, "-") {
+		return nil, fmt.Errorf("%q is negative", value)
+	}
+	if strings.HasPrefix(str, "0x") {
+		if !weiHexRegex.MatchString(str) {
+			return nil, fmt.Errorf("%q is not valid hex", value)
+		}
+		number, ok := math.ParseBig256(str)
+		if !ok {
+			return nil, fmt.Errorf("%q is larger than 2^256-1", value)
+		}
+		return number, nil
+	}
+
+	match := weiDecimalRegex.FindStringSubmatch(str)
+	if match == nil {
+		return nil, fmt.Errorf("%q is not a decimal or 0x prefixed hex integer", value)
+	}
+	whole, fraction, unit := match[1], match[2], match[3]
+	if unit == "" {
+		unit = "wei"
+	}
+	decimals, knownUnit := weiUnitDecimals[unit]
+	if !knownUnit {
+		return nil, fmt.Errorf("%q has the unknown unit %s, use wei, gwei or ether", value, unit)
+	}
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > decimals {
+		return nil, fmt.Errorf("%q is not a whole number of wei", value)
+	}
+	number, _ := new(big.Int).SetString(whole+fraction+strings.Repeat("0", decimals-len(fraction)), 10)
+	if number.BitLen() > 256 {
+		return nil, fmt.Errorf("%q is larger than 2^256-1", value)
+	}
+	return number, nil
+}
+
+// withParsedValues : Adds the nonce and amounts the transaction was built with, in wei, to a response's data
+func (args *txArgs) withParsedValues(respData map[string]interface{}) map[string]interface{} {
+	respData["nonce"] = args.Nonce
+	respData["amount_wei"] = "0"
+	respData["gas_price_wei"] = "0"
+	if args.Amount != nil {
+		respData["amount_wei"] = args.Amount.String()
+	}
+	if args.GasPrice != nil {
+		respData["gas_price_wei"] = args.GasPrice.String()
+	}
+	if args.TxType == dynamicFeeTxType {
+		delete(respData, "gas_price_wei")
+		respData["max_fee_per_gas_wei"] = args.MaxFeePerGas.String()
+		respData["max_priority_fee_per_gas_wei"] = args.MaxPriorityFeePerGas.String()
+	}
+	return respData
+}
+
+// previewFields : The transaction as it would be signed, for preview-tx
+func (args *txArgs) previewFields() map[string]interface{} {
+	fields := args.withParsedValues(map[string]interface{}{
+		"tx_type":   args.TxType,
+		"chain_id":  args.ChainID,
+		"nonce":     args.Nonce,
+		"gas_limit": args.GasLimit,
+		"to":        nil,
+		"data":      "0x" + args.Data,
+		"private":   args.Private,
+	})
+	if args.To != nil {
+		fields["to"] = args.To.Hex()
+	}
+	if args.TxType != legacyTxType {
+		fields["access_list"] = args.AccessList
+	}
+	return fields
+}
+
+// ContractAddress : The address a contract deployment from sender will create, derived from the sender and nonce.
+func (args *txArgs) ContractAddress(sender string) string {
+	return crypto.CreateAddress(common.HexToAddress(sender), args.Nonce).Hex()
+}
@@ -0,0 +1,54 @@
+package guardian
+
+import "testing"
+
+func TestParseWei(t *testing.T) {
+	maxUint256 := "115792089237316195423570985008687907853269984665640564039457584007913129639935"
+	for _, test := range []struct {
+		value string
+		want  string
+	}{
+		{"0", "0"},
+		{"21000", "21000"},
+		{"21000 wei", "21000"},
+		{"20gwei", "20000000000"},
+		{"1.5 ether", "1500000000000000000"},
+		{"1.5 ETHER", "1500000000000000000"},
+		{"0.000000001 ether", "1000000000"},
+		{"2.50 gwei", "2500000000"},
+		{" 7 ", "7"},
+		{"0x0", "0"},
+		{"0xde0b6b3a7640000", "1000000000000000000"},
+		{"0XFF", "255"},
+		{maxUint256, maxUint256},
+		{"0x" + "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", maxUint256},
+	} {
+		got, err := parseWei(test.value)
+		if err != nil {
+			t.Errorf("%q: %v", test.value, err)
+		} else if got.String() != test.want {
+			t.Errorf("%q parsed to %s, want %s", test.value, got, test.want)
+		}
+	}
+
+	for _, value := range []string{
+		"",
+		"-1",
+		"-0x1",
+		"1.5",
+		"1.5 wei",
+		"0.0000000001 gwei",
+		"1 finney",
+		"1e18",
+		"0x",
+		"0xg1",
+		"1,000",
+		"115792089237316195423570985008687907853269984665640564039457584007913129639936",
+		"0x1" + "0000000000000000000000000000000000000000000000000000000000000000",
+		"115792089237316195423570985008687907853269984665640564039457.584007913129639936 ether",
+	} {
+		if got, err := parseWei(value); err == nil {
+			t.Errorf("%q was accepted as %s", value, got)
+		}
+	}
+}
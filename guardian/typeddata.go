@@ -0,0 +1,325 @@
+package guardian
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/eximchain/go-ethereum/common"
+	"github.com/eximchain/go-ethereum/common/math"
+	"github.com/eximchain/go-ethereum/crypto"
+)
+
+// TypedData : An EIP-712 payload, as given to eth_signTypedData_v4.
+// https://eips.ethereum.org/EIPS/eip-712
+type TypedData struct {
+	Types       map[string][]TypedDataField `json:"types"`
+	PrimaryType string                      `json:"primaryType"`
+	Domain      map[string]interface{}      `json:"domain"`
+	Message     map[string]interface{}      `json:"message"`
+}
+
+// TypedDataField : One member of a struct type.
+type TypedDataField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+const typedDataDomainType = "EIP712Domain"
+
+var (
+	typedDataArrayRegex = regexp.MustCompile(`^(.+)\[([0-9]*)\]$`)
+	typedDataIntRegex   = regexp.MustCompile(`^(u?)int([0-9]*)$`)
+	typedDataBytesRegex = regexp.MustCompile(`^bytes([0-9]+)$`)
+	typedDataNameRegex  = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+)
+
+// ParseTypedData : Decodes the JSON payload, keeping numbers exact
+func ParseTypedData(typedDataJSON []byte) (*TypedData, error) {
+	decoder := json.NewDecoder(bytes.NewReader(typedDataJSON))
+	decoder.UseNumber()
+	var typedData TypedData
+	if err := decoder.Decode(&typedData); err != nil {
+		return nil, err
+	}
+	if err := typedData.validate(); err != nil {
+		return nil, err
+	}
+	return &typedData, nil
+}
+
+// HashTypedData : Returns the digest to sign, keccak256("\x19\x01" ‖ domainSeparator ‖ hashStruct(message)),
+// along with the domain separator and struct hash it was built from.
+func (td *TypedData) HashTypedData() (hash, domainSeparator, structHash []byte, err error) {
+	domainSeparator, err = td.hashStruct(typedDataDomainType, td.Domain)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("domain: %v", err)
+	}
+	structHash, err = td.hashStruct(td.PrimaryType, td.Message)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("message: %v", err)
+	}
+	hash = crypto.Keccak256([]byte{0x19, 0x01}, domainSeparator, structHash)
+	return hash, domainSeparator, structHash, nil
+}
+
+func (td *TypedData) validate() error {
+	if _, ok := td.Types[typedDataDomainType]; !ok {
+		return fmt.Errorf("types must define %s", typedDataDomainType)
+	}
+	if td.PrimaryType == "" {
+		return errors.New("primaryType is required")
+	}
+	if _, ok := td.Types[td.PrimaryType]; !ok {
+		return fmt.Errorf("primaryType %s is not defined in types", td.PrimaryType)
+	}
+	if td.Domain == nil || td.Message == nil {
+		return errors.New("domain and message are required")
+	}
+	for typeName, fields := range td.Types {
+		if !typedDataNameRegex.MatchString(typeName) {
+			return fmt.Errorf("%q is not a valid type name", typeName)
+		}
+		seen := map[string]bool{}
+		for _, field := range fields {
+			if !typedDataNameRegex.MatchString(field.Name) {
+				return fmt.Errorf("%s has a field with the invalid name %q", typeName, field.Name)
+			}
+			if seen[field.Name] {
+				return fmt.Errorf("%s defines the field %s twice", typeName, field.Name)
+			}
+			seen[field.Name] = true
+			if !td.isKnownType(field.Type) {
+				return fmt.Errorf("%s.%s has the unknown type %s", typeName, field.Name, field.Type)
+			}
+		}
+	}
+	return nil
+}
+
+func (td *TypedData) isKnownType(typeName string) bool {
+	if match := typedDataArrayRegex.FindStringSubmatch(typeName); match != nil {
+		return td.isKnownType(match[1])
+	}
+	if _, ok := td.Types[typeName]; ok {
+		return true
+	}
+	_, err := typedDataAtomicSize(typeName)
+	return err == nil || typeName == "string" || typeName == "bytes"
+}
+
+// encodeType : "Name(type1 name1,...)" for the type followed by every struct it references, sorted by name
+func (td *TypedData) encodeType(primaryType string) string {
+	deps := td.dependencies(primaryType, map[string]bool{})
+	sort.Strings(deps)
+	deps = append([]string{primaryType}, deps...)
+
+	var encoded strings.Builder
+	for _, dep := range deps {
+		encoded.WriteString(dep + "(")
+		for i, field := range td.Types[dep] {
+			if i > 0 {
+				encoded.WriteString(",")
+			}
+			encoded.WriteString(field.Type + " " + field.Name)
+		}
+		encoded.WriteString(")")
+	}
+	return encoded.String()
+}
+
+// dependencies : Struct types referenced by typeName, directly or not, excluding itself
+func (td *TypedData) dependencies(typeName string, found map[string]bool) []string {
+	found[typeName] = true
+	var deps []string
+	for _, field := range td.Types[typeName] {
+		fieldType := typedDataBaseType(field.Type)
+		if _, isStruct := td.Types[fieldType]; isStruct && !found[fieldType] {
+			deps = append(deps, fieldType)
+			deps = append(deps, td.dependencies(fieldType, found)...)
+		}
+	}
+	return deps
+}
+
+func (td *TypedData) hashStruct(typeName string, data map[string]interface{}) ([]byte, error) {
+	fields := td.Types[typeName]
+	if len(data) > len(fields) {
+		return nil, fmt.Errorf("%s has values for fields it does not define", typeName)
+	}
+	encoded := crypto.Keccak256([]byte(td.encodeType(typeName)))
+	for _, field := range fields {
+		value, ok := data[field.Name]
+		if !ok {
+			return nil, fmt.Errorf("%s.%s is missing", typeName, field.Name)
+		}
+		encodedValue, err := td.encodeValue(field.Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", typeName, field.Name, err)
+		}
+		encoded = append(encoded, encodedValue...)
+	}
+	return crypto.Keccak256(encoded), nil
+}
+
+// encodeValue : The 32 byte encoding of a value, dynamic and struct values are replaced by their hash
+func (td *TypedData) encodeValue(typeName string, value interface{}) ([]byte, error) {
+	if match := typedDataArrayRegex.FindStringSubmatch(typeName); match != nil {
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an array for %s", typeName)
+		}
+		if match[2] != "" {
+			if length, _ := strconv.Atoi(match[2]); length != len(items) {
+				return nil, fmt.Errorf("expected %d items for %s, got %d", length, typeName, len(items))
+			}
+		}
+		var encoded []byte
+		for i, item := range items {
+			encodedItem, err := td.encodeValue(match[1], item)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %v", i, err)
+			}
+			encoded = append(encoded, encodedItem...)
+		}
+		return crypto.Keccak256(encoded), nil
+	}
+
+	if _, isStruct := td.Types[typeName]; isStruct {
+		data, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an object for %s", typeName)
+		}
+		return td.hashStruct(typeName, data)
+	}
+
+	switch typeName {
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return nil, errors.New("expected a string")
+		}
+		return crypto.Keccak256([]byte(str)), nil
+	case "bytes":
+		raw, err := parseJSONHexBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.Keccak256(raw), nil
+	case "bool":
+		flag, ok := value.(bool)
+		if !ok {
+			return nil, errors.New("expected true or false")
+		}
+		if flag {
+			return math.PaddedBigBytes(big.NewInt(1), 32), nil
+		}
+		return make([]byte, 32), nil
+	case "address":
+		str, ok := value.(string)
+		if !ok || !common.IsHexAddress(str) {
+			return nil, errors.New("expected a hex address")
+		}
+		return common.LeftPadBytes(common.HexToAddress(str).Bytes(), 32), nil
+	}
+
+	if match := typedDataBytesRegex.FindStringSubmatch(typeName); match != nil {
+		size, _ := strconv.Atoi(match[1])
+		raw, err := parseJSONHexBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) != size {
+			return nil, fmt.Errorf("expected %d bytes, got %d", size, len(raw))
+		}
+		return common.RightPadBytes(raw, 32), nil
+	}
+
+	if match := typedDataIntRegex.FindStringSubmatch(typeName); match != nil {
+		size, _ := typedDataAtomicSize(typeName)
+		number, err := parseJSONInteger(value)
+		if err != nil {
+			return nil, err
+		}
+		if match[1] == "u" {
+			if number.Sign() < 0 || number.BitLen() > size {
+				return nil, fmt.Errorf("%s is out of range for %s", number, typeName)
+			}
+			return math.PaddedBigBytes(number, 32), nil
+		}
+		bound := new(big.Int).Lsh(big.NewInt(1), uint(size-1))
+		if number.Cmp(bound) >= 0 || number.Cmp(new(big.Int).Neg(bound)) < 0 {
+			return nil, fmt.Errorf("%s is out of range for %s", number, typeName)
+		}
+		return math.PaddedBigBytes(math.U256(new(big.Int).Set(number)), 32), nil
+	}
+	return nil, fmt.Errorf("unknown type %s", typeName)
+}
+
+// typedDataAtomicSize : Bit size of uintN and intN types, byte size of bytesN types
+func typedDataAtomicSize(typeName string) (int, error) {
+	if match := typedDataIntRegex.FindStringSubmatch(typeName); match != nil {
+		if match[2] == "" {
+			return 256, nil
+		}
+		size, _ := strconv.Atoi(match[2])
+		if size < 8 || size > 256 || size%8 != 0 {
+			return 0, fmt.Errorf("invalid integer type %s", typeName)
+		}
+		return size, nil
+	}
+	if match := typedDataBytesRegex.FindStringSubmatch(typeName); match != nil {
+		size, _ := strconv.Atoi(match[1])
+		if size < 1 || size > 32 {
+			return 0, fmt.Errorf("invalid bytes type %s", typeName)
+		}
+		return size, nil
+	}
+	if typeName == "bool" || typeName == "address" {
+		return 0, nil
+	}
+	return 0, fmt.Errorf("unknown type %s", typeName)
+}
+
+func typedDataBaseType(typeName string) string {
+	for {
+		match := typedDataArrayRegex.FindStringSubmatch(typeName)
+		if match == nil {
+			return typeName
+		}
+		typeName = match[1]
+	}
+}
+
+func parseJSONHexBytes(value interface{}) ([]byte, error) {
+	str, ok := value.(string)
+	if !ok || !strings.HasPrefix(str, "0x") {
+		return nil, errors.New("expected 0x prefixed hex")
+	}
+	return hex.DecodeString(str[2:])
+}
+
+// parseJSONInteger : Integers may be JSON numbers, decimal strings or 0x prefixed hex strings
+func parseJSONInteger(value interface{}) (*big.Int, error) {
+	var str string
+	switch typed := value.(type) {
+	case json.Number:
+		str = typed.String()
+	case string:
+		str = typed
+	default:
+		return nil, errors.New("expected an integer")
+	}
+	number, ok := math.ParseBig256(str)
+	if !ok || str == "" {
+		return nil, fmt.Errorf("%q is not an integer", str)
+	}
+	return number, nil
+}
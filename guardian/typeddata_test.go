@@ -0,0 +1,143 @@
+package guardian
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// eip712MailJSON : The example from the EIP-712 specification
+const eip712MailJSON = `{
+	"types": {
+		"EIP712Domain": [
+			{"name": "name", "type": "string"},
+			{"name": "version", "type": "string"},
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"Person": [
+			{"name": "name", "type": "string"},
+			{"name": "wallet", "type": "address"}
+		],
+		"Mail": [
+			{"name": "from", "type": "Person"},
+			{"name": "to", "type": "Person"},
+			{"name": "contents", "type": "string"}
+		]
+	},
+	"primaryType": "Mail",
+	"domain": {
+		"name": "Ether Mail",
+		"version": "1",
+		"chainId": 1,
+		"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+	},
+	"message": {
+		"from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+		"to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+		"contents": "Hello, Bob!"
+	}
+}`
+
+// eip712NestedArraysJSON : The Mail example with arrays of addresses and of structs, as eth_signTypedData_v4 accepts
+const eip712NestedArraysJSON = `{
+	"types": {
+		"EIP712Domain": [
+			{"name": "name", "type": "string"},
+			{"name": "version", "type": "string"},
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"Person": [
+			{"name": "name", "type": "string"},
+			{"name": "wallets", "type": "address[]"}
+		],
+		"Mail": [
+			{"name": "from", "type": "Person"},
+			{"name": "to", "type": "Person[]"},
+			{"name": "contents", "type": "string"}
+		],
+		"Group": [
+			{"name": "name", "type": "string"},
+			{"name": "members", "type": "Person[]"}
+		]
+	},
+	"primaryType": "Mail",
+	"domain": {
+		"name": "Ether Mail",
+		"version": "1",
+		"chainId": 1,
+		"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+	},
+	"message": {
+		"from": {
+			"name": "Cow",
+			"wallets": ["0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826", "0xDeaDbeefdEAdbeefdEadbEEFdeadbeEFdEaDbeeF"]
+		},
+		"to": [{
+			"name": "Bob",
+			"wallets": [
+				"0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB",
+				"0xB0BdaBea57B0BDABeA57b0bdABEA57b0BDabEa57",
+				"0xB0B0b0b0b0b0B000000000000000000000000000"
+			]
+		}],
+		"contents": "Hello, Bob!"
+	}
+}`
+
+func TestHashTypedDataVectors(t *testing.T) {
+	cases := map[string]struct {
+		typedDataJSON                      string
+		encodedType                        string
+		domainSeparator, structHash, final string
+	}{
+		"EIP-712 Mail": {
+			eip712MailJSON,
+			"Mail(Person from,Person to,string contents)Person(string name,address wallet)",
+			"f2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f",
+			"c52c0ee5d84264471806290a3f2c4cecfc5490626bf912d01f240d7a274b371e",
+			"be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2",
+		},
+		"nested arrays": {
+			eip712NestedArraysJSON,
+			"Mail(Person from,Person[] to,string contents)Person(string name,address[] wallets)",
+			"f2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f",
+			"eb4221181ff3f1a83ea7313993ca9218496e424604ba9492bb4052c03d5c3df8",
+			"a85c2e2b118698e88db68a8105b794a8cc7cec074e89ef991cb4f5f533819cc2",
+		},
+	}
+	for name, c := range cases {
+		typedData, err := ParseTypedData([]byte(c.typedDataJSON))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if encodedType := typedData.encodeType(typedData.PrimaryType); encodedType != c.encodedType {
+			t.Errorf("%s: encoded type %s, want %s", name, encodedType, c.encodedType)
+		}
+		hash, domainSeparator, structHash, err := typedData.HashTypedData()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := hex.EncodeToString(domainSeparator); got != c.domainSeparator {
+			t.Errorf("%s: domain separator %s, want %s", name, got, c.domainSeparator)
+		}
+		if got := hex.EncodeToString(structHash); got != c.structHash {
+			t.Errorf("%s: struct hash %s, want %s", name, got, c.structHash)
+		}
+		if got := hex.EncodeToString(hash); got != c.final {
+			t.Errorf("%s: digest %s, want %s", name, got, c.final)
+		}
+	}
+}
+
+func TestParseTypedDataRefuses(t *testing.T) {
+	cases := map[string]string{
+		"unknown type":    `{"types":{"EIP712Domain":[],"Mail":[{"name":"from","type":"Persn"}]},"primaryType":"Mail","domain":{},"message":{}}`,
+		"unknown primary": `{"types":{"EIP712Domain":[]},"primaryType":"Mail","domain":{},"message":{}}`,
+	}
+	for name, typedDataJSON := range cases {
+		if _, err := ParseTypedData([]byte(typedDataJSON)); err == nil {
+			t.Errorf("%s: was parsed", name)
+		}
+	}
+}
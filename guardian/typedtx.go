@@ -0,0 +1,205 @@
+package guardian
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/eximchain/go-ethereum/common"
+	"github.com/eximchain/go-ethereum/common/hexutil"
+	"github.com/eximchain/go-ethereum/crypto"
+	"github.com/eximchain/go-ethereum/rlp"
+)
+
+// EIP-2718 transaction types, legacy transactions have no type byte
+// https://eips.ethereum.org/EIPS/eip-2718
+const (
+	legacyTxType     = 0
+	accessListTxType = 1
+	dynamicFeeTxType = 2
+)
+
+// AccessTuple : One entry of an EIP-2930 access list, an address and the storage slots the transaction will touch.
+type AccessTuple struct {
+	Address     common.Address `json:"address"`
+	StorageKeys []common.Hash  `json:"storageKeys"`
+}
+
+// parseAccessList : Decodes a JSON access list, as eth_createAccessList returns it.
+func parseAccessList(accessListJSON string) ([]AccessTuple, error) {
+	var tuples []struct {
+		Address     string   `json:"address"`
+		StorageKeys []string `json:"storageKeys"`
+	}
+	if err := json.Unmarshal([]byte(accessListJSON), &tuples); err != nil {
+		return nil, fmt.Errorf("access_list must be a JSON array of {address, storageKeys}: %v", err)
+	}
+	accessList := make([]AccessTuple, len(tuples))
+	for i, tuple := range tuples {
+		if !common.IsHexAddress(tuple.Address) {
+			return nil, fmt.Errorf("access_list entry %d has an invalid address", i)
+		}
+		accessList[i] = AccessTuple{Address: common.HexToAddress(tuple.Address), StorageKeys: []common.Hash{}}
+		for _, key := range tuple.StorageKeys {
+			decoded, err := hexutil.Decode(key)
+			if err != nil || len(decoded) != common.HashLength {
+				return nil, fmt.Errorf("access_list entry %d has a storage key which is not 32 bytes of 0x prefixed hex", i)
+			}
+			accessList[i].StorageKeys = append(accessList[i].StorageKeys, common.BytesToHash(decoded))
+		}
+	}
+	return accessList, nil
+}
+
+// typedTxPayload : The fields of an EIP-2930 or EIP-1559 transaction, in the order they are RLP encoded.
+// GasPrice is only encoded for type 1, MaxPriorityFeePerGas and MaxFeePerGas only for type 2.
+type typedTxPayload struct {
+	txType               byte
+	ChainID              *big.Int
+	Nonce                uint64
+	GasPrice             *big.Int
+	MaxPriorityFeePerGas *big.Int
+	MaxFeePerGas         *big.Int
+	GasLimit             uint64
+	To                   []byte
+	Value                *big.Int
+	Data                 []byte
+	AccessList           []AccessTuple
+}
+
+func (p *typedTxPayload) fields() []interface{} {
+	if p.txType == accessListTxType {
+		return []interface{}{p.ChainID, p.Nonce, p.GasPrice, p.GasLimit, p.To, p.Value, p.Data, p.AccessList}
+	}
+	return []interface{}{p.ChainID, p.Nonce, p.MaxPriorityFeePerGas, p.MaxFeePerGas, p.GasLimit, p.To, p.Value, p.Data, p.AccessList}
+}
+
+// envelope : The type byte followed by the RLP list of fields, the form both signing and broadcasting use
+func (p *typedTxPayload) envelope(fields []interface{}) ([]byte, error) {
+	encoded, err := rlp.EncodeToBytes(fields)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{p.txType}, encoded...), nil
+}
+
+// signingHash : keccak256 of the envelope without the signature fields
+func (p *typedTxPayload) signingHash() ([]byte, error) {
+	unsigned, err := p.envelope(p.fields())
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256(unsigned), nil
+}
+
+// signTypedTxWithHexKey : Signs the args as an EIP-2930 or EIP-1559 transaction, returning its JSON
+// as eth_getTransactionByHash shows it and the 0x prefixed envelope for eth_sendRawTransaction.
+func signTypedTxWithHexKey(args *txArgs, privKeyHex string) (jsonTx, rlpTx string, err error) {
+	payload, err := newTypedTxPayload(args)
+	if err != nil {
+		return "", "", err
+	}
+	hash, err := payload.signingHash()
+	if err != nil {
+		return "", "", err
+	}
+	sig, err := SignWithHexKey(hash, privKeyHex)
+	if err != nil {
+		return "", "", err
+	}
+	yParity, r, s := uint64(sig[64]), new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:64])
+	signed, err := payload.envelope(append(payload.fields(), yParity, r, s))
+	if err != nil {
+		return "", "", err
+	}
+
+	txJSON := map[string]interface{}{
+		"type":       hexutil.Uint64(payload.txType),
+		"chainId":    (*hexutil.Big)(payload.ChainID),
+		"nonce":      hexutil.Uint64(payload.Nonce),
+		"gas":        hexutil.Uint64(payload.GasLimit),
+		"to":         args.To,
+		"value":      (*hexutil.Big)(payload.Value),
+		"input":      hexutil.Bytes(payload.Data),
+		"accessList": payload.AccessList,
+		"v":          hexutil.Uint64(yParity),
+		"r":          (*hexutil.Big)(r),
+		"s":          (*hexutil.Big)(s),
+		"hash":       common.BytesToHash(crypto.Keccak256(signed)),
+	}
+	if payload.txType == accessListTxType {
+		txJSON["gasPrice"] = (*hexutil.Big)(payload.GasPrice)
+	} else {
+		txJSON["maxPriorityFeePerGas"] = (*hexutil.Big)(payload.MaxPriorityFeePerGas)
+		txJSON["maxFeePerGas"] = (*hexutil.Big)(payload.MaxFeePerGas)
+	}
+	encodedJSON, err := json.Marshal(txJSON)
+	if err != nil {
+		return "", "", err
+	}
+	return string(encodedJSON), hexutil.Encode(signed), nil
+}
+
+// newTypedTxPayload : The unsigned fields of the args' EIP-2930 or EIP-1559 transaction
+func newTypedTxPayload(args *txArgs) (*typedTxPayload, error) {
+	dataBytes, err := hex.DecodeString(args.Data)
+	if err != nil {
+		return nil, err
+	}
+	payload := &typedTxPayload{
+		txType:               byte(args.TxType),
+		ChainID:              big.NewInt(int64(args.ChainID)),
+		Nonce:                args.Nonce,
+		GasPrice:             bigOrZero(args.GasPrice),
+		MaxPriorityFeePerGas: bigOrZero(args.MaxPriorityFeePerGas),
+		MaxFeePerGas:         bigOrZero(args.MaxFeePerGas),
+		GasLimit:             args.GasLimit,
+		To:                   []byte{},
+		Value:                bigOrZero(args.Amount),
+		Data:                 dataBytes,
+		AccessList:           args.AccessList,
+	}
+	if payload.AccessList == nil {
+		payload.AccessList = []AccessTuple{}
+	}
+	if args.To != nil {
+		payload.To = args.To.Bytes()
+	}
+	return payload, nil
+}
+
+// validateTxType : Checks the fee fields given match the transaction type
+func (args *txArgs) validateTxType() error {
+	switch args.TxType {
+	case legacyTxType:
+		if args.AccessList != nil || args.MaxFeePerGas != nil || args.MaxPriorityFeePerGas != nil {
+			return errors.New("`access_list`, `max_fee_per_gas` and `max_priority_fee_per_gas` need a `tx_type` of 1 or 2.")
+		}
+	case accessListTxType:
+		if args.MaxFeePerGas != nil || args.MaxPriorityFeePerGas != nil {
+			return errors.New("`tx_type` 1 takes a `gas_price`, use `tx_type` 2 for `max_fee_per_gas` and `max_priority_fee_per_gas`.")
+		}
+	case dynamicFeeTxType:
+		if args.GasPrice != nil {
+			return errors.New("`tx_type` 2 takes `max_fee_per_gas` and `max_priority_fee_per_gas` instead of a `gas_price`.")
+		}
+		if args.MaxFeePerGas == nil || args.MaxPriorityFeePerGas == nil {
+			return errors.New("`tx_type` 2 requires both `max_fee_per_gas` and `max_priority_fee_per_gas`.")
+		}
+		if args.MaxPriorityFeePerGas.Cmp(args.MaxFeePerGas) > 0 {
+			return errors.New("`max_priority_fee_per_gas` cannot be more than `max_fee_per_gas`.")
+		}
+	default:
+		return fmt.Errorf("`tx_type` %d is not supported, use 0 (legacy), 1 (EIP-2930) or 2 (EIP-1559).", args.TxType)
+	}
+	return nil
+}
+
+func bigOrZero(value *big.Int) *big.Int {
+	if value == nil {
+		return new(big.Int)
+	}
+	return value
+}
@@ -0,0 +1,73 @@
+package guardian
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/eximchain/go-ethereum/common"
+)
+
+// Expected values are from go-ethereum v1.13.15, signing with types.LatestSignerForChainID
+func TestTypedTxKnownAnswers(t *testing.T) {
+	privKeyHex := "b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291"
+	to := common.HexToAddress("0x095e7baea6a6c7c4c2dfeb977efac326af552d87")
+	gwei := big.NewInt(1000000000)
+	for _, test := range []struct {
+		name        string
+		args        *txArgs
+		signingHash string
+		signed      string
+		txHash      string
+	}{
+		{
+			name: "EIP-2930 with an access list",
+			args: &txArgs{TxType: accessListTxType, ChainID: 1, Nonce: 3, GasLimit: 25000, To: &to, Amount: big.NewInt(10),
+				GasPrice: new(big.Int).Mul(big.NewInt(20), gwei), Data: "5544",
+				AccessList: []AccessTuple{{Address: to, StorageKeys: []common.Hash{common.HexToHash("0x01"), common.HexToHash("0x02")}}}},
+			signingHash: "0x7ca6d761834d8d6cf9f48234763dd7d9f5d868b0b0ea1bf9ff70aa80105c0c2f",
+			signed:      "0x01f8c401038504a817c8008261a894095e7baea6a6c7c4c2dfeb977efac326af552d870a825544f85bf85994095e7baea6a6c7c4c2dfeb977efac326af552d87f842a00000000000000000000000000000000000000000000000000000000000000001a0000000000000000000000000000000000000000000000000000000000000000201a07730e5d636640ff4ca61a33b468705ba8e1210d80d88d05a0184a967eab6943ba03436d3af4cdb9badf288dd9fd12a2a057a9b925b1d9c172c73a8790bf1376009",
+			txHash:      "0x5c84aa3eecdeebe1fe9a2653dc328c85cf7f02bc9b18664d82a636f2dd68bd52",
+		},
+		{
+			name: "EIP-1559 transfer",
+			args: &txArgs{TxType: dynamicFeeTxType, ChainID: 1, Nonce: 7, GasLimit: 21000, To: &to, Amount: new(big.Int).Mul(gwei, gwei),
+				MaxPriorityFeePerGas: new(big.Int).Mul(big.NewInt(2), gwei), MaxFeePerGas: new(big.Int).Mul(big.NewInt(30), gwei)},
+			signingHash: "0xc12f11b577ba2663a9dabb8027926c46c1e01a48d216782ac839d2856174599e",
+			signed:      "0x02f873010784773594008506fc23ac0082520894095e7baea6a6c7c4c2dfeb977efac326af552d87880de0b6b3a764000080c080a072b1a5cf29d8e6ae482b0e949cc0e6372c64a943318d5c77bb895064a0a37092a01539053b4ea8e732cfc91ba8afb2cc468817755b35dd8b3d5dfa276a002ce83d",
+			txHash:      "0x8a2479881d434989f13bc1779b9b9b5fe995c64f52b37f58037639a855307ed1",
+		},
+		{
+			name: "EIP-1559 deployment",
+			args: &txArgs{TxType: dynamicFeeTxType, ChainID: 1284, Nonce: 0, GasLimit: 100000, Data: "6080604052",
+				MaxPriorityFeePerGas: gwei, MaxFeePerGas: new(big.Int).Mul(big.NewInt(5), gwei)},
+			signingHash: "0x5258cdd108a8e49b30c4da92da29f4aed06ecbe2c168fea7589f83729aee2654",
+			signed:      "0x02f85f82050480843b9aca0085012a05f200830186a08080856080604052c001a02fd3deea0f2cc5b3e2109fe776fe94b21513cf23a15597c560814e62d39855a8a02d192e81ad9cc6cf9fdff2033650cac73c9fd907866570ce3b10c334ae3f373d",
+			txHash:      "0xd200e1bfa70c07f1e56968bdb19458bb1f8eb000ef93455d43a126bc89179dff",
+		},
+	} {
+		hash, err := test.args.SigningHash()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := common.BytesToHash(hash).Hex(); got != test.signingHash {
+			t.Errorf("%s: signing hash %s, want %s", test.name, got, test.signingHash)
+		}
+		jsonTx, rlpTx, err := test.args.signWithHexKey(privKeyHex)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if rlpTx != test.signed {
+			t.Errorf("%s: signed envelope\n%s\nwant\n%s", test.name, rlpTx, test.signed)
+		}
+		var decoded struct {
+			Hash string `json:"hash"`
+		}
+		if err := json.Unmarshal([]byte(jsonTx), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Hash != test.txHash {
+			t.Errorf("%s: transaction hash %s, want %s", test.name, decoded.Hash, test.txHash)
+		}
+	}
+}
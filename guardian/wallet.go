@@ -0,0 +1,211 @@
+package guardian
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// Wallet : A user's keys as held in the plugin's own storage, so key material never leaves the plugin.
+// The mnemonic every address is derived from is sealed under the plugin's master key, accounts
+// created before HD wallets hold a single private key instead.
+type Wallet struct {
+	KeyMaterial
+	PublicAddressHex string    `json:"public_address_hex"`
+	CreatedAt        time.Time `json:"created_at"`
+	// ArchivedVersions holds the wallets this one replaced on rotation, oldest first.
+	ArchivedVersions []ArchivedKey `json:"archived_versions,omitempty"`
+}
+
+// ArchivedKey : A retired version of a wallet or named key, kept so funds on its addresses stay reachable.
+type ArchivedKey struct {
+	Version int `json:"version"`
+	KeyMaterial
+	PublicAddressHex string    `json:"public_address_hex"`
+	CreatedAt        time.Time `json:"created_at"`
+	RetiredAt        time.Time `json:"retired_at"`
+}
+
+// NewWallet : Generates a fresh HD wallet, PublicAddressHex is set to the address at index 0.
+func NewWallet(cfg *Config) (*Wallet, error) {
+	mnemonic, err := CreateMnemonic()
+	if err != nil {
+		return nil, err
+	}
+	_, pubAddress, err := DeriveKeyFromMnemonic(mnemonic, 0)
+	if err != nil {
+		return nil, err
+	}
+	material, err := sealKeyMaterial(cfg, mnemonic, "")
+	if err != nil {
+		return nil, err
+	}
+	return &Wallet{KeyMaterial: material, PublicAddressHex: pubAddress, CreatedAt: time.Now().UTC()}, nil
+}
+
+// Version : Versions count up from 1, the current wallet is always the latest.
+func (w *Wallet) Version() int {
+	return len(w.ArchivedVersions) + 1
+}
+
+// Rotate : Archives the current wallet and replaces it with a freshly generated one.
+func (w *Wallet) Rotate(cfg *Config) error {
+	fresh, err := NewWallet(cfg)
+	if err != nil {
+		return err
+	}
+	w.ArchivedVersions = append(w.ArchivedVersions, ArchivedKey{
+		Version:          w.Version(),
+		KeyMaterial:      w.KeyMaterial,
+		PublicAddressHex: w.PublicAddressHex,
+		CreatedAt:        w.CreatedAt,
+		RetiredAt:        fresh.CreatedAt,
+	})
+	w.KeyMaterial = fresh.KeyMaterial
+	w.PublicAddressHex = fresh.PublicAddressHex
+	w.CreatedAt = fresh.CreatedAt
+	return nil
+}
+
+// AtVersion : Returns the wallet as it was at the given version, without any history.
+func (w *Wallet) AtVersion(version int) (*Wallet, error) {
+	if version == w.Version() {
+		return &Wallet{KeyMaterial: w.KeyMaterial, PublicAddressHex: w.PublicAddressHex, CreatedAt: w.CreatedAt}, nil
+	}
+	if version < 1 || version > w.Version() {
+		return nil, fmt.Errorf("version must be between 1 and %d", w.Version())
+	}
+	archived := w.ArchivedVersions[version-1]
+	return &Wallet{KeyMaterial: archived.KeyMaterial, PublicAddressHex: archived.PublicAddressHex, CreatedAt: archived.CreatedAt}, nil
+}
+
+// Address : Returns the address for the given address index.
+func (w *Wallet) Address(cfg *Config, addressIndex int) (pubAddress string, err error) {
+	if addressIndex == 0 {
+		return w.PublicAddressHex, nil
+	}
+	if w.AccountPublicKey != "" {
+		return DeriveAddressFromAccountPublicKey(w.AccountPublicKey, addressIndex)
+	}
+	err = w.withKeyHex(cfg, addressIndex, func(privKeyHex string) error {
+		pubAddress, err = AddressFromHexKey(privKeyHex)
+		return err
+	})
+	return pubAddress, err
+}
+
+// Addresses : Returns the addresses for the first `count` address indexes.
+func (w *Wallet) Addresses(cfg *Config, count int) (pubAddresses []string, err error) {
+	if !w.IsHD() {
+		return []string{w.PublicAddressHex}, nil
+	}
+	if w.AccountPublicKey != "" {
+		pubAddresses = make([]string, count)
+		for i := range pubAddresses {
+			if pubAddresses[i], err = DeriveAddressFromAccountPublicKey(w.AccountPublicKey, i); err != nil {
+				return nil, err
+			}
+		}
+		return pubAddresses, nil
+	}
+	err = w.withMnemonic(cfg, func(mnemonic string) error {
+		pubAddresses, err = DeriveAddressesFromMnemonic(mnemonic, count)
+		return err
+	})
+	return pubAddresses, err
+}
+
+// rewrap : Rewraps the current and archived key material under the latest master key.
+func (w *Wallet) rewrap(cfg *Config) (changed bool, err error) {
+	changed, err = w.KeyMaterial.rewrap(cfg)
+	if err != nil {
+		return false, err
+	}
+	for i := range w.ArchivedVersions {
+		archivedChanged, err := w.ArchivedVersions[i].KeyMaterial.rewrap(cfg)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || archivedChanged
+	}
+	return changed, nil
+}
+
+const walletStoragePrefix = "wallets/"
+
+func walletStoragePath(username string) string {
+	return walletStoragePrefix + username
+}
+
+func (b *backend) readWallet(ctx context.Context, s logical.Storage, username string) (*Wallet, error) {
+	entry, err := s.Get(ctx, walletStoragePath(username))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var wallet Wallet
+	if err := entry.DecodeJSON(&wallet); err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
+
+func (b *backend) writeWallet(ctx context.Context, s logical.Storage, username string, wallet *Wallet) error {
+	entry, err := logical.StorageEntryJSON(walletStoragePath(username), wallet)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+func (b *backend) listWallets(ctx context.Context, s logical.Storage) ([]string, error) {
+	return s.List(ctx, walletStoragePrefix)
+}
+
+func (b *backend) readWalletByUsername(ctx context.Context, s logical.Storage, username string) (*Wallet, error) {
+	wallet, err := b.readWallet(ctx, s, username)
+	if err != nil {
+		return nil, err
+	}
+	if wallet == nil {
+		return nil, fmt.Errorf("no key found for %s, it may need to be imported with migrate-keys", username)
+	}
+	return wallet, nil
+}
+
+func (b *backend) readWalletByEntityID(ctx context.Context, req *logical.Request, client *Client) (*Wallet, error) {
+	username, usernameErr := client.usernameFromEntityID(req.EntityID)
+	if usernameErr != nil {
+		return nil, usernameErr
+	}
+	return b.readWalletByUsername(ctx, req.Storage, username)
+}
+
+// walletFromKeySecret : Converts a secret from the legacy /keys KV mount into a sealed Wallet.
+func walletFromKeySecret(cfg *Config, keyData map[string]interface{}) (*Wallet, error) {
+	privKeyHex, _ := keyData["privKeyHex"].(string)
+	mnemonic, _ := keyData["mnemonic"].(string)
+	if privKeyHex == "" && mnemonic == "" {
+		return nil, errors.New("secret holds neither privKeyHex nor mnemonic")
+	}
+	var pubAddress string
+	var err error
+	if mnemonic != "" {
+		_, pubAddress, err = DeriveKeyFromMnemonic(mnemonic, 0)
+	} else {
+		pubAddress, err = AddressFromHexKey(privKeyHex)
+	}
+	if err != nil {
+		return nil, err
+	}
+	material, err := sealKeyMaterial(cfg, mnemonic, privKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	return &Wallet{KeyMaterial: material, PublicAddressHex: pubAddress, CreatedAt: time.Now().UTC()}, nil
+}